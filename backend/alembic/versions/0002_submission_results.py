@@ -0,0 +1,44 @@
+"""Add submission results
+
+Revision ID: 0002
+Revises: 0001
+Create Date: 2026-10-14 10:00:00.000000
+
+"""
+from alembic import op
+import sqlalchemy as sa
+
+# revision identifiers, used by Alembic.
+revision = '0002'
+down_revision = '0001'
+branch_labels = None
+depends_on = None
+
+
+def upgrade() -> None:
+    op.create_table('submission_results',
+    sa.Column('id', sa.Integer(), nullable=False),
+    sa.Column('created_at', sa.DateTime(timezone=True), server_default=sa.text('now()'), nullable=False),
+    sa.Column('updated_at', sa.DateTime(timezone=True), server_default=sa.text('now()'), nullable=False),
+    sa.Column('submission_id', sa.String(length=64), nullable=False),
+    sa.Column('language', sa.String(length=50), nullable=False),
+    sa.Column('status', sa.String(length=50), nullable=False),
+    sa.Column('stdout', sa.Text(), nullable=False),
+    sa.Column('stderr', sa.Text(), nullable=False),
+    sa.Column('exit_code', sa.Integer(), nullable=True),
+    sa.Column('timed_out', sa.Boolean(), nullable=False),
+    sa.Column('error_message', sa.Text(), nullable=True),
+    sa.Column('duration_ms', sa.Integer(), nullable=False),
+    sa.Column('compile_duration_ms', sa.Integer(), nullable=False),
+    sa.Column('run_duration_ms', sa.Integer(), nullable=False),
+    sa.Column('memory_used_bytes', sa.BigInteger(), nullable=False),
+    sa.PrimaryKeyConstraint('id')
+    )
+    op.create_index(op.f('ix_submission_results_id'), 'submission_results', ['id'], unique=False)
+    op.create_index(op.f('ix_submission_results_submission_id'), 'submission_results', ['submission_id'], unique=True)
+
+
+def downgrade() -> None:
+    op.drop_index(op.f('ix_submission_results_submission_id'), table_name='submission_results')
+    op.drop_index(op.f('ix_submission_results_id'), table_name='submission_results')
+    op.drop_table('submission_results')
@@ -0,0 +1,24 @@
+"""Allow submission results without a memory reading
+
+Revision ID: 0003
+Revises: 0002
+Create Date: 2026-10-14 12:00:00.000000
+
+"""
+from alembic import op
+import sqlalchemy as sa
+
+# revision identifiers, used by Alembic.
+revision = '0003'
+down_revision = '0002'
+branch_labels = None
+depends_on = None
+
+
+def upgrade() -> None:
+    op.alter_column('submission_results', 'memory_used_bytes', existing_type=sa.BigInteger(), nullable=True)
+
+
+def downgrade() -> None:
+    op.execute('UPDATE submission_results SET memory_used_bytes = 0 WHERE memory_used_bytes IS NULL')
+    op.alter_column('submission_results', 'memory_used_bytes', existing_type=sa.BigInteger(), nullable=False)
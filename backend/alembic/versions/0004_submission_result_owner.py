@@ -0,0 +1,29 @@
+"""Record who submitted each submission result
+
+Revision ID: 0004
+Revises: 0003
+Create Date: 2026-10-14 13:00:00.000000
+
+"""
+from alembic import op
+import sqlalchemy as sa
+
+# revision identifiers, used by Alembic.
+revision = '0004'
+down_revision = '0003'
+branch_labels = None
+depends_on = None
+
+
+def upgrade() -> None:
+    op.add_column('submission_results', sa.Column('user_id', sa.Integer(), nullable=True))
+    op.create_index(op.f('ix_submission_results_user_id'), 'submission_results', ['user_id'], unique=False)
+    op.create_foreign_key(
+        'fk_submission_results_user_id_users', 'submission_results', 'users', ['user_id'], ['id']
+    )
+
+
+def downgrade() -> None:
+    op.drop_constraint('fk_submission_results_user_id_users', 'submission_results', type_='foreignkey')
+    op.drop_index(op.f('ix_submission_results_user_id'), table_name='submission_results')
+    op.drop_column('submission_results', 'user_id')
@@ -0,0 +1,23 @@
+"""Store the signal that killed a submission
+
+Revision ID: 0005
+Revises: 0004
+Create Date: 2026-10-14 14:00:00.000000
+
+"""
+from alembic import op
+import sqlalchemy as sa
+
+# revision identifiers, used by Alembic.
+revision = '0005'
+down_revision = '0004'
+branch_labels = None
+depends_on = None
+
+
+def upgrade() -> None:
+    op.add_column('submission_results', sa.Column('signal', sa.String(length=16), nullable=True))
+
+
+def downgrade() -> None:
+    op.drop_column('submission_results', 'signal')
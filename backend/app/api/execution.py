@@ -1,32 +1,52 @@
-from typing import List
+from typing import Annotated, Awaitable, Callable, List, Optional, TypeVar
 
-from fastapi import APIRouter, Depends, HTTPException, status
+from fastapi import APIRouter, Depends, Header, HTTPException, Query, status
 from fastapi.security import HTTPBearer
 
 from app.core.deps import get_current_user
+from app.core.execution_languages import InvalidSubmissionError, UnsupportedLanguageError
 from app.models.user import User
 from app.schemas.execution import (
+    BenchmarkReport,
     CodeExecutionRequest,
     ExecutionResult,
+    JobRequest,
+    JobResult,
     LanguageInfo,
+    LanguageLimits,
+    RunRequest,
+    RunResult,
     ValidationRequest,
     ValidationResult
 )
-from app.services.execution import execution_service
+from app.services.execution import EmptySourceError, ExecutionUnavailableError, LimitTooHighError, execution_service
+from app.services.execution_benchmark import MAX_BENCHMARK_ITERATIONS, benchmark
+from app.services.execution_callbacks import CallbackUrlError
+from app.services.execution_idempotency import IdempotencyKeyReusedError, idempotency_keys, request_fingerprint
+from app.services.execution_scheduler import QueueFullError, SchedulerClosedError, execution_scheduler
 
 router = APIRouter()
 security = HTTPBearer()
 
+T = TypeVar("T")
+
+# Sent by clients that may retry a submission; repeats under one key share its first result
+IdempotencyKey = Annotated[Optional[str], Header(alias="Idempotency-Key", min_length=1, max_length=255)]
+
 
 @router.post("/execute", response_model=ExecutionResult)
 async def execute_code(
     request: CodeExecutionRequest,
-    current_user: User = Depends(get_current_user)
+    current_user: User = Depends(get_current_user),
+    idempotency_key: IdempotencyKey = None
 ):
     """Execute code with test cases in a secure environment."""
     try:
-        result = await execution_service.execute_code(request)
-        return result
+        return await _once(
+            "execute", request, current_user, idempotency_key, lambda: execution_service.execute_code(request)
+        )
+    except HTTPException:
+        raise
     except Exception as e:
         raise HTTPException(
             status_code=status.HTTP_500_INTERNAL_SERVER_ERROR,
@@ -34,6 +54,113 @@ async def execute_code(
         )
 
 
+@router.post("/run", response_model=RunResult)
+async def run_code(
+    request: RunRequest,
+    current_user: User = Depends(get_current_user),
+    idempotency_key: IdempotencyKey = None
+):
+    """Run code once against the given stdin and return its output."""
+    async def run() -> RunResult:
+        job_id = await _submit_job(request, user_id=current_user.id)
+        # Timeouts come back as a result with timed_out set, not an error
+        return (await execution_scheduler.result(job_id, wait=True)).result
+    
+    # Shares the result rather than the job, so a repeat of a run that failed internally runs again
+    return await _once("run", request, current_user, idempotency_key, run)
+
+
+@router.post("/jobs", response_model=JobResult, status_code=status.HTTP_202_ACCEPTED)
+async def submit_job(
+    request: JobRequest,
+    current_user: User = Depends(get_current_user),
+    idempotency_key: IdempotencyKey = None
+):
+    """Queue code to run and return immediately with the job ID, POSTing the result to callback_url if set."""
+    if request.callback_url and execution_scheduler.callbacks is None:
+        raise HTTPException(
+            status_code=status.HTTP_400_BAD_REQUEST,
+            detail="Job callbacks are not enabled on this server"
+        )
+    run_request = RunRequest.model_validate(request.model_dump(exclude={"callback_url"}))
+    callback_url = str(request.callback_url) if request.callback_url else None
+    if callback_url:
+        try:
+            # Checked again when the callback is sent, in case the host's DNS changes meanwhile
+            await execution_scheduler.callbacks.check_url(callback_url)
+        except CallbackUrlError as e:
+            raise HTTPException(
+                status_code=status.HTTP_400_BAD_REQUEST,
+                detail=str(e)
+            )
+    job_id = await _once(
+        "jobs", request, current_user, idempotency_key, lambda: _submit_job(run_request, callback_url, current_user.id)
+    )
+    return await execution_scheduler.result(job_id, user_id=current_user.id)
+
+
+@router.get("/jobs/{job_id}", response_model=JobResult)
+async def get_job(
+    job_id: str,
+    current_user: User = Depends(get_current_user)
+):
+    """Get the status of one of the user's queued jobs, including its result once completed."""
+    try:
+        # Another user's job is reported missing, not forbidden, so its ID gives nothing away
+        return await execution_scheduler.result(job_id, user_id=current_user.id)
+    except KeyError:
+        raise HTTPException(
+            status_code=status.HTTP_404_NOT_FOUND,
+            detail="Job not found"
+        )
+
+
+async def _once(
+    endpoint: str,
+    request,
+    current_user: User,
+    idempotency_key: Optional[str],
+    start: Callable[[], Awaitable[T]]
+) -> T:
+    """Run start(), or with an Idempotency-Key, share the first run's result with every repeat of it."""
+    if idempotency_key is None:
+        return await start()
+    try:
+        # Scoped per user and endpoint, so one client's keys never collide with another's
+        return await idempotency_keys.run(
+            f"{current_user.id}:{endpoint}:{idempotency_key}", request_fingerprint(request), start
+        )
+    except IdempotencyKeyReusedError as e:
+        raise HTTPException(
+            status_code=status.HTTP_422_UNPROCESSABLE_ENTITY,
+            detail=str(e)
+        )
+
+
+async def _submit_job(request: RunRequest, callback_url: Optional[str] = None, user_id: Optional[int] = None) -> str:
+    try:
+        # Cheap checks up front so bad submissions never reach the queue
+        execution_service.validate(request)
+    except EmptySourceError as e:
+        raise HTTPException(
+            status_code=status.HTTP_422_UNPROCESSABLE_ENTITY,
+            detail=str(e)
+        )
+    except InvalidSubmissionError as e:
+        raise HTTPException(
+            status_code=status.HTTP_400_BAD_REQUEST,
+            detail=str(e)
+        )
+    
+    try:
+        return execution_scheduler.submit(request, callback_url=callback_url, user_id=user_id)
+    except (QueueFullError, SchedulerClosedError) as e:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail=str(e)
+        )
+
+
 @router.post("/validate", response_model=ValidationResult)
 async def validate_syntax(
     request: ValidationRequest,
@@ -64,6 +191,65 @@ async def get_supported_languages(
         )
 
 
+@router.put("/languages/{name}/limits", response_model=LanguageLimits)
+async def update_language_limits(
+    name: str,
+    limits: LanguageLimits,
+    current_user: User = Depends(get_current_user)
+):
+    """Change a language's default limits for later submissions (admin only)."""
+    if current_user.role != "admin":
+        raise HTTPException(
+            status_code=status.HTTP_403_FORBIDDEN,
+            detail="Only administrators can change language limits"
+        )
+    
+    try:
+        return execution_service.update_language_limits(name, limits)
+    except UnsupportedLanguageError as e:
+        raise HTTPException(
+            status_code=status.HTTP_404_NOT_FOUND,
+            detail=str(e)
+        )
+    except LimitTooHighError as e:
+        raise HTTPException(
+            status_code=status.HTTP_400_BAD_REQUEST,
+            detail=str(e)
+        )
+
+
+@router.post("/languages/{name}/benchmark", response_model=BenchmarkReport)
+async def benchmark_language(
+    name: str,
+    iterations: int = Query(default=10, ge=1, le=MAX_BENCHMARK_ITERATIONS),
+    current_user: User = Depends(get_current_user)
+):
+    """Measure a language's cold-start and pooled executor overhead with a trivial program (admin only)."""
+    if current_user.role != "admin":
+        raise HTTPException(
+            status_code=status.HTTP_403_FORBIDDEN,
+            detail="Only administrators can benchmark languages"
+        )
+    
+    try:
+        return await benchmark(name, iterations)
+    except UnsupportedLanguageError as e:
+        raise HTTPException(
+            status_code=status.HTTP_404_NOT_FOUND,
+            detail=str(e)
+        )
+    except InvalidSubmissionError as e:
+        raise HTTPException(
+            status_code=status.HTTP_400_BAD_REQUEST,
+            detail=str(e)
+        )
+    except ExecutionUnavailableError as e:
+        raise HTTPException(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            detail=str(e)
+        )
+
+
 @router.post("/build-images")
 async def build_docker_images(
     current_user: User = Depends(get_current_user)
@@ -1,5 +1,5 @@
 from pydantic_settings import BaseSettings
-from typing import List, Optional
+from typing import Dict, List, Optional
 import os
 
 
@@ -29,6 +29,31 @@ class Settings(BaseSettings):
     docker_timeout: int = 30
     max_memory_mb: int = 128
     max_cpu_percent: int = 50
+    execution_pool_size: int = 0  # warm containers kept per language; 0 disables pooling
+    execution_max_concurrent: int = 4
+    execution_max_queue: int = 100
+    execution_max_completed_jobs: int = 1000  # finished jobs kept in memory for polling; older ones are read back from the result store
+    execution_language_workers: Dict[str, int] = {}  # concurrent runs per language, e.g. {"cpp": 2}; unlisted languages only share the limit above
+    execution_allow_network: bool = False  # give sandboxes a network; keep off for untrusted code
+    execution_read_only_root_fs: bool = True  # only the tmpfs workdir and /tmp are writable in sandboxes
+    execution_allow_binary_upload: bool = False  # accept precompiled executables in place of source; their code is never reviewed
+    execution_pids_limit: int = 64  # cgroup cap on processes and threads per sandbox, whatever the submission asks for
+    execution_max_timeout_ms: int = 60000  # caps on what a submission may request; can lower but not raise the schema bounds
+    execution_max_memory_bytes: int = 512 * 1024 * 1024
+    execution_max_cpu_quota: float = 8
+    execution_max_output_bytes: int = 16 * 1024 * 1024
+    execution_kill_grace_seconds: float = 2.0  # SIGTERM to SIGKILL delay for timed-out programs, like docker stop
+    execution_seccomp_profile: str = ""  # path to a custom seccomp JSON profile; empty uses docker/execution/seccomp.json
+    execution_result_cache_size: int = 256  # results kept for cacheable runs; 0 disables the cache
+    execution_result_cache_ttl_seconds: int = 300
+    execution_idempotency_ttl_seconds: int = 3600  # how long a repeated Idempotency-Key returns its first submission's result
+    execution_idempotency_max_entries: int = 10000  # keys remembered at once; the oldest are forgotten first
+    execution_callback_secret: str = ""  # HMAC key signing job callbacks; empty rejects jobs with a callback_url
+    execution_callback_attempts: int = 3  # tries per callback, with exponential backoff between them
+    execution_callback_allowed_hosts: List[str] = []  # callback hosts trusted even if they resolve to private addresses, e.g. an internal grader
+    execution_shutdown_timeout_seconds: int = 30  # time in-flight jobs get to finish on shutdown before they're killed
+    execution_pull_images: bool = True  # pull missing executor images at startup; off for air-gapped hosts
+    execution_docker_retry_attempts: int = 3  # tries per container start on transient Docker errors
     
     # File Storage
     upload_dir: str = "./uploads"
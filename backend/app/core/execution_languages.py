@@ -0,0 +1,332 @@
+"""
+Language registry for the code execution service.
+
+Each supported language is described by a LanguageConfig and registered
+under its name, so adding a language doesn't require touching the executor.
+"""
+
+import re
+from dataclasses import dataclass, field, replace
+from pathlib import Path
+from typing import Dict, List, Optional, Tuple
+
+from app.schemas.execution import Language
+
+
+class InvalidSubmissionError(ValueError):
+    """Base for submissions that are rejected before anything is run."""
+
+
+class UnsupportedLanguageError(InvalidSubmissionError):
+    """Raised when a submission names a language that isn't registered."""
+
+    def __init__(self, language: str):
+        self.language = language
+        super().__init__(f"Unsupported language: {language}")
+
+
+class UnsupportedLanguageVersionError(UnsupportedLanguageError):
+    """Raised when a submission pins a version the language doesn't offer."""
+
+    def __init__(self, language: str, version: str, available):
+        self.language = language
+        self.version = version
+        ValueError.__init__(
+            self,
+            f"Unsupported version {version} for language {language} "
+            f"(available: {', '.join(available) or 'none'})"
+        )
+
+
+class InvalidFilenameError(InvalidSubmissionError):
+    """Raised when a submitted path escapes the workdir or doesn't suit the language."""
+
+
+class InvalidCompileArgError(InvalidSubmissionError):
+    """Raised when a submission passes a compiler flag its language doesn't allow."""
+
+
+@dataclass
+class LanguageVersion:
+    """A pinned toolchain variant of a language, run from its own image."""
+    image: str
+    dockerfile: Optional[str] = None  # defaults to the language's dockerfile
+    build_args: Dict[str, str] = field(default_factory=dict)
+
+
+@dataclass
+class LanguageConfig:
+    """
+    How to build and run submissions for a single language.
+
+    build_cmd and run_cmd are templates formatted with {filename} (the source
+    file), {stem} (its path without the extension), {output} (the compiled
+    artifact, named by output_filename) and, for Java, {classname}. project_files are written alongside every
+    submission unless it provides its own file at the same path.
+
+    version names the toolchain the base image provides; versions holds
+    other pinnable variants, selected with get_language_config(name, version).
+    env is set for every build and run on top of the image's own environment;
+    a submission's env is merged over it. runtime_threads is added to the
+    sandbox's process limits for runtimes that need their own threads, such
+    as the JVM's GC and compiler threads. compile_timeout bounds the build
+    step separately from the program's default_timeout, for slow compilers.
+
+    default_memory_bytes, default_cpu_quota and default_timeout apply when a
+    submission doesn't set its own limits; None falls back to the service
+    defaults. set_language_limits() changes them at runtime.
+
+    allowed_compile_args are regexes a submission's compile_args must each
+    fully match; they are appended to build_cmd, or substituted for
+    {compile_args} where flags have to come earlier. compile_arg_env adds
+    build environment variables for flags that need them, like CGO for
+    Go's -race.
+
+    accepts_binary marks languages whose build output is a native
+    executable run by run_cmd, so an uploaded precompiled binary can be
+    written in place of {output} and the build skipped.
+    """
+    image: str
+    run_cmd: str
+    source_filename: str
+    build_cmd: Optional[str] = None
+    output_filename: str = "program"
+    project_files: Dict[str, str] = field(default_factory=dict)
+    version: Optional[str] = None
+    build_args: Dict[str, str] = field(default_factory=dict)
+    versions: Dict[str, LanguageVersion] = field(default_factory=dict)
+    env: Dict[str, str] = field(default_factory=dict)
+    runtime_threads: int = 0
+    default_memory_bytes: Optional[int] = None
+    default_cpu_quota: Optional[float] = None
+    default_timeout: float = 10  # seconds
+    compile_timeout: int = 30  # seconds
+    allowed_compile_args: Tuple[str, ...] = ()
+    compile_arg_env: Dict[str, Dict[str, str]] = field(default_factory=dict)
+    dockerfile: Optional[str] = None
+    version_cmd: Optional[str] = None
+    accepts_binary: bool = False
+
+    @property
+    def file_extension(self) -> str:
+        return Path(self.source_filename).suffix
+
+    @property
+    def is_compiled(self) -> bool:
+        return self.build_cmd is not None
+
+
+_LANGUAGES: Dict[str, LanguageConfig] = {}
+
+
+def _language_key(name) -> str:
+    # Language members and plain strings both resolve to the enum value
+    return getattr(name, "value", name)
+
+
+def register_language(name: str, config: LanguageConfig) -> None:
+    """Register (or replace) the configuration for a language."""
+    _LANGUAGES[_language_key(name)] = config
+
+
+def set_language_limits(
+    name: str,
+    default_memory_bytes: Optional[int],
+    default_cpu_quota: Optional[float],
+    default_timeout: float
+) -> LanguageConfig:
+    """
+    Replace a registered language's default limits, raising if it isn't registered.
+
+    The registered config is swapped rather than mutated, so submissions
+    already holding the old one finish with the limits they started with.
+    """
+    config = replace(
+        get_language_config(name),
+        default_memory_bytes=default_memory_bytes,
+        default_cpu_quota=default_cpu_quota,
+        default_timeout=default_timeout
+    )
+    register_language(name, config)
+    return config
+
+
+def validate_source_filename(config: LanguageConfig, filename: str) -> str:
+    """Check that a filename override has the language's source extension."""
+    if Path(filename).suffix != config.file_extension:
+        raise InvalidFilenameError(
+            f"Filename {filename!r} must have the {config.file_extension} extension"
+        )
+    return filename
+
+
+def validate_compile_args(config: LanguageConfig, args: List[str]) -> List[str]:
+    """Check each compiler flag against the language's allowlist."""
+    if args and not config.is_compiled:
+        raise InvalidCompileArgError("Compile arguments are only accepted for compiled languages")
+    for arg in args:
+        if not any(re.fullmatch(pattern, arg) for pattern in config.allowed_compile_args):
+            raise InvalidCompileArgError(f"Compile argument {arg!r} is not allowed")
+    return args
+
+
+def get_language_config(name: str, version: Optional[str] = None) -> LanguageConfig:
+    """
+    Look up a language's configuration, raising if it isn't registered.
+
+    With a version, the returned config uses that variant's image; unknown
+    versions raise rather than falling back to the default toolchain.
+    """
+    try:
+        config = _LANGUAGES[_language_key(name)]
+    except KeyError:
+        raise UnsupportedLanguageError(_language_key(name)) from None
+
+    if version is None or version == config.version:
+        return config
+    if version not in config.versions:
+        available = sorted({*config.versions, *([config.version] if config.version else [])})
+        raise UnsupportedLanguageVersionError(_language_key(name), version, available)
+    variant = config.versions[version]
+    return replace(
+        config,
+        image=variant.image,
+        dockerfile=variant.dockerfile or config.dockerfile,
+        build_args=variant.build_args,
+        version=version
+    )
+
+
+def is_language_registered(name: str) -> bool:
+    return _language_key(name) in _LANGUAGES
+
+
+def registered_languages() -> Dict[str, LanguageConfig]:
+    """Snapshot of all registered languages keyed by name."""
+    return dict(_LANGUAGES)
+
+
+register_language(Language.PYTHON, LanguageConfig(
+    image="assessment-python-executor",
+    dockerfile="backend/docker/execution/Dockerfile.python",
+    source_filename="main.py",
+    run_cmd="python3 {filename}",
+    version_cmd="python3 --version",
+))
+
+register_language(Language.JAVASCRIPT, LanguageConfig(
+    image="assessment-js-executor",
+    dockerfile="backend/docker/execution/Dockerfile.node",
+    source_filename="main.js",
+    run_cmd="node {filename}",
+    version_cmd="node --version",
+))
+
+register_language(Language.JAVA, LanguageConfig(
+    image="assessment-java-executor",
+    dockerfile="backend/docker/execution/Dockerfile.java",
+    source_filename="Main.java",
+    build_cmd="javac -encoding UTF-8 {filename}",
+    # Serial GC and C1-only JIT keep the JVM's thread count and startup time down
+    run_cmd="java -XX:+UseSerialGC -XX:TieredStopAtLevel=1 -cp . {classname}",
+    version_cmd="java --version",
+    runtime_threads=32,
+    # The JVM's heap, metaspace and JIT don't fit the 128 MB default, and it starts slowly
+    default_memory_bytes=256 * 1024 * 1024,
+    default_timeout=15,
+    allowed_compile_args=(r"-Werror", r"-Xlint(:[a-z,-]+)?", r"-g", r"-nowarn", r"-deprecation"),
+))
+
+register_language(Language.CPP, LanguageConfig(
+    image="assessment-cpp-executor",
+    dockerfile="backend/docker/execution/Dockerfile.cpp",
+    source_filename="main.cpp",
+    build_cmd="g++ -O2 -std=c++17 {filename} -o {output}",
+    output_filename="main",
+    run_cmd="./{output}",
+    version_cmd="g++ --version",
+    accepts_binary=True,
+    # No -Wl/-Wa/-Wp: those hand arbitrary options to the linker, assembler and preprocessor
+    allowed_compile_args=(
+        r"-O[0-3s]", r"-std=(c|gnu)\+\+\d\d", r"-W[a-z][a-z0-9+-]*(=[a-z0-9-]+)?",
+        r"-pedantic(-errors)?", r"-g", r"-D[A-Za-z_]\w*(=\w+)?",
+    ),
+))
+
+register_language(Language.CSHARP, LanguageConfig(
+    image="assessment-csharp-executor",
+    dockerfile="backend/docker/execution/Dockerfile.csharp",
+    source_filename="Program.cs",
+    # Artifacts go to the writable workdir; /tmp is noexec and the rest of the root is read-only
+    build_cmd="dotnet build -o {output}",
+    output_filename="out",
+    run_cmd="dotnet {output}/program.dll",
+    version_cmd="dotnet --version",
+))
+
+register_language(Language.GO, LanguageConfig(
+    image="assessment-go-executor",
+    dockerfile="backend/docker/execution/Dockerfile.go",
+    version="1.21",
+    build_args={"GO_VERSION": "1.21"},
+    versions={
+        "1.22": LanguageVersion(image="assessment-go1.22-executor", build_args={"GO_VERSION": "1.22"}),
+    },
+    source_filename="main.go",
+    # Build the whole package so helper files and subpackages resolve; flags must precede it
+    build_cmd="go build {compile_args} -o {output} .",
+    project_files={"go.mod": "module submission\n\ngo 1.21\n"},
+    run_cmd="./{output}",
+    version_cmd="go version",
+    accepts_binary=True,
+    allowed_compile_args=(r"-race", r"-trimpath", r"-tags=[\w,]+"),
+    # The race detector is built on cgo, which the image otherwise disables
+    compile_arg_env={"-race": {"CGO_ENABLED": "1"}},
+))
+
+register_language(Language.RUST, LanguageConfig(
+    image="assessment-rust-executor",
+    dockerfile="backend/docker/execution/Dockerfile.rust",
+    source_filename="main.rs",
+    build_cmd="rustc -O {filename} -o {output}",
+    output_filename="main",
+    run_cmd="./{output}",
+    version_cmd="rustc --version",
+    accepts_binary=True,
+    allowed_compile_args=(r"-[DWA](warnings|[a-z][a-z0-9_-]*)", r"--edition=20(15|18|21)", r"-g"),
+    # Optimised builds of even small programs can take rustc tens of seconds
+    compile_timeout=60,
+))
+
+register_language(Language.PHP, LanguageConfig(
+    image="assessment-php-executor",
+    dockerfile="backend/docker/execution/Dockerfile.php",
+    source_filename="main.php",
+    # php -l parses without running, so syntax errors are reported as compilation errors;
+    # fatals at run time (exit code 255) are runtime errors
+    build_cmd="php -l {filename}",
+    run_cmd="php {filename}",
+    version_cmd="php --version",
+))
+
+register_language(Language.TYPESCRIPT, LanguageConfig(
+    image="assessment-typescript-executor",
+    dockerfile="backend/docker/execution/Dockerfile.typescript",
+    source_filename="main.ts",
+    # Type errors fail the build with tsc's diagnostics and nothing is emitted; --rootDir keeps
+    # each source's path under {output}, so the entry point compiles to {output}/{stem}.js
+    build_cmd=(
+        "tsc --strict --noEmitOnError --pretty false --target es2022 --module commonjs"
+        " --typeRoots /usr/local/lib/node_modules/@types --types node"
+        " --rootDir . --outDir {output} {filename}"
+    ),
+    output_filename="out",
+    run_cmd="node {output}/{stem}.js",
+    version_cmd="tsc --version",
+    # tsc loads the Node typings to check against, which doesn't fit the 128 MB default
+    default_memory_bytes=256 * 1024 * 1024,
+    allowed_compile_args=(
+        r"--(noUnusedLocals|noUnusedParameters|noImplicitReturns|noFallthroughCasesInSwitch"
+        r"|noUncheckedIndexedAccess|exactOptionalPropertyTypes)",
+    ),
+))
@@ -113,6 +113,25 @@ class ExecutionSecurityConfig:
             r'std::net::TcpStream',
             r'unsafe\s*{',
             r'std::process::exit',
+        ],
+        Language.PHP: [
+            r'\b(shell_exec|exec|system|passthru|proc_open|popen|pcntl_\w+)\s*\(',
+            r'\b(fsockopen|stream_socket_client|curl_init)\s*\(',
+            r'`[^`]*`',
+            r'\beval\s*\(',
+            r'\b(file_put_contents|unlink)\s*\(',
+            r'\bexit\s*\(',
+        ],
+        Language.TYPESCRIPT: [
+            r'require\s*\(\s*["\']fs["\']',
+            r'require\s*\(\s*["\']child_process["\']',
+            r'require\s*\(\s*["\']net["\']',
+            r'require\s*\(\s*["\']https?["\']',
+            r'from\s+["\'](fs|child_process|net|https?)["\']',
+            r'process\.exit',
+            r'process\.kill',
+            r'eval\s*\(',
+            r'Function\s*\(',
         ]
     }
     
@@ -229,9 +248,9 @@ class ExecutionSecurityConfig:
         """Calculate maximum nesting depth in code."""
         if language == Language.PYTHON:
             return cls._calculate_python_nesting(code)
-        elif language in [Language.JAVA, Language.CSHARP, Language.CPP, Language.RUST, Language.GO]:
+        elif language in [Language.JAVA, Language.CSHARP, Language.CPP, Language.RUST, Language.GO, Language.PHP]:
             return cls._calculate_brace_nesting(code)
-        elif language == Language.JAVASCRIPT:
+        elif language in [Language.JAVASCRIPT, Language.TYPESCRIPT]:
             return cls._calculate_brace_nesting(code)
         return 0
     
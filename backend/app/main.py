@@ -1,7 +1,12 @@
-from fastapi import FastAPI
+import asyncio
+from fastapi import FastAPI, Response, status
+from fastapi.responses import JSONResponse
 from fastapi.middleware.cors import CORSMiddleware
 from fastapi.middleware.trustedhost import TrustedHostMiddleware
 from app.core.config import settings
+from app.services.execution import ExecutionUnavailableError, execution_service
+from app.services.execution_scheduler import execution_scheduler
+from prometheus_client import CONTENT_TYPE_LATEST, generate_latest
 import structlog
 
 # Configure structured logging
@@ -63,6 +68,34 @@ async def health_check():
     return {"status": "healthy", "environment": settings.environment}
 
 
+@app.get("/healthz")
+async def readiness_check():
+    """Readiness check: 200 only when submitted code can actually be executed"""
+    try:
+        await asyncio.to_thread(execution_service.healthcheck)
+    except ExecutionUnavailableError as e:
+        logger.warning("Execution unavailable", error=str(e))
+        return JSONResponse(
+            status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+            content={"status": "unavailable", "detail": str(e)}
+        )
+    return {"status": "ready"}
+
+
+@app.get("/metrics")
+async def metrics():
+    """Prometheus metrics from the default registry, including execution statistics"""
+    return Response(content=generate_latest(), media_type=CONTENT_TYPE_LATEST)
+
+
+@app.on_event("shutdown")
+async def drain_executions():
+    """Let submitted code finish and save its results before the process exits"""
+    await execution_scheduler.shutdown(settings.execution_shutdown_timeout_seconds)
+    if execution_service.pool is not None:
+        await asyncio.to_thread(execution_service.pool.close)
+
+
 # Include API routers
 from app.api.auth import router as auth_router
 from app.api.assessments import router as assessment_router
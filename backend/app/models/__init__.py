@@ -4,6 +4,7 @@ from .assessment import Assessment
 from .question import Question, QuestionType
 from .attempt import AssessmentAttempt, AttemptStatus
 from .answer import Answer
+from .execution_result import SubmissionResult
 
 __all__ = [
     "BaseModel",
@@ -16,4 +17,5 @@ __all__ = [
     "AssessmentAttempt",
     "AttemptStatus",
     "Answer",
+    "SubmissionResult",
 ]
\ No newline at end of file
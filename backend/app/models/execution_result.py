@@ -0,0 +1,26 @@
+from sqlalchemy import Column, Integer, String, Text, Boolean, BigInteger, ForeignKey
+from .base import BaseModel
+
+
+class SubmissionResult(BaseModel):
+    __tablename__ = "submission_results"
+    
+    submission_id = Column(String(64), unique=True, index=True, nullable=False)
+    language = Column(String(50), nullable=False)
+    user_id = Column(Integer, ForeignKey("users.id"), nullable=True, index=True)  # Who submitted it; only they can read it
+    status = Column(String(50), nullable=False)  # ExecutionStatus value; a string so new statuses need no migration
+    stdout = Column(Text, nullable=False, default="")  # Truncated to STORED_OUTPUT_CHARS
+    stderr = Column(Text, nullable=False, default="")
+    exit_code = Column(Integer, nullable=True)
+    signal = Column(String(16), nullable=True)  # e.g. SIGSEGV, for runtime errors from a signal
+    timed_out = Column(Boolean, nullable=False, default=False)
+    error_message = Column(Text, nullable=True)
+    
+    # Timings and resource usage
+    duration_ms = Column(Integer, nullable=False, default=0)
+    compile_duration_ms = Column(Integer, nullable=False, default=0)
+    run_duration_ms = Column(Integer, nullable=False, default=0)
+    memory_used_bytes = Column(BigInteger, nullable=True)  # None when the peak couldn't be measured
+    
+    def __repr__(self):
+        return f"<SubmissionResult(submission_id='{self.submission_id}', language='{self.language}', status='{self.status}')>"
@@ -1,7 +1,48 @@
+import re
+from datetime import datetime
 from typing import List, Optional, Dict, Any
-from pydantic import BaseModel, Field
+from pydantic import Base64Bytes, BaseModel, ConfigDict, Field, HttpUrl, field_validator, model_validator
 from enum import Enum
 
+# Relative paths of plain name segments; also keeps them safe to use unquoted in shell commands
+SUBMISSION_PATH_PATTERN = re.compile(r"^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$")
+
+
+def validate_submission_path(path: str) -> str:
+    """Reject absolute paths, traversal and anything outside the allowed characters."""
+    if not SUBMISSION_PATH_PATTERN.match(path) or any(part in (".", "..") for part in path.split("/")):
+        raise ValueError(f"Invalid file path: {path!r}")
+    return path
+
+
+# Exec environment names: no '=' or shell metacharacters, so a name can't smuggle in another variable
+ENV_VAR_NAME_PATTERN = re.compile(r"^[A-Za-z_][A-Za-z0-9_]{0,127}$")
+
+# Variables that control the toolchain, loader or sandbox; submissions can't override them
+PROTECTED_ENV_VARS = frozenset({
+    "PATH", "HOME", "USER", "SHELL", "HOSTNAME",
+    "CGO_ENABLED", "GOPROXY", "GOSUMDB", "GOFLAGS", "GOCACHE", "GOPATH", "GOROOT", "GOTOOLCHAIN",
+    "NODE_OPTIONS", "NODE_PATH", "NODE_ENV",
+    "PYTHONPATH", "PYTHONHOME", "PYTHONSTARTUP", "PYTHONDONTWRITEBYTECODE", "PYTHONHASHSEED",
+    "JAVA_TOOL_OPTIONS", "_JAVA_OPTIONS", "JDK_JAVA_OPTIONS", "CLASSPATH",
+    "RUSTFLAGS", "RUST_BACKTRACE", "DOTNET_ROOT",
+})
+PROTECTED_ENV_PREFIXES = ("LD_", "DYLD_")
+
+# Compiler flags are spliced into the build command, so only plain option characters are allowed
+COMPILE_ARG_PATTERN = re.compile(r"^-[A-Za-z0-9_=.,:+-]*$")
+
+
+def validate_env_var(name: str, value: str) -> str:
+    """Reject malformed names, protected variables and values Docker can't pass through."""
+    if not ENV_VAR_NAME_PATTERN.match(name):
+        raise ValueError(f"Invalid environment variable name: {name!r}")
+    if name.upper() in PROTECTED_ENV_VARS or name.upper().startswith(PROTECTED_ENV_PREFIXES):
+        raise ValueError(f"Environment variable {name} is protected and can't be overridden")
+    if "\x00" in value or len(value) > 4096:
+        raise ValueError(f"Invalid value for environment variable {name}")
+    return name
+
 
 class Language(str, Enum):
     PYTHON = "python"
@@ -11,11 +52,47 @@ class Language(str, Enum):
     CSHARP = "csharp"
     GO = "go"
     RUST = "rust"
+    PHP = "php"
+    TYPESCRIPT = "typescript"
+
+
+class Architecture(str, Enum):
+    """CPU architecture a precompiled binary was built for."""
+    X86_64 = "x86_64"
+    AARCH64 = "aarch64"
+
+
+class OutputEncoding(str, Enum):
+    """How a run's output is returned; programs may write bytes that aren't valid UTF-8."""
+    UTF8 = "utf8"  # text only, with invalid bytes replaced by U+FFFD
+    BASE64 = "base64"  # the text, plus the exact bytes base64-encoded
+
+
+class CompareMode(str, Enum):
+    """How a test case's expected output is compared with the program's."""
+    EXACT = "exact"
+    IGNORE_TRAILING_NEWLINES = "ignore_trailing_newlines"
+    TRIM_TRAILING_WHITESPACE = "trim_trailing_whitespace"
+    TOKEN_WISE = "token_wise"
+    FLOAT_TOLERANCE = "float_tolerance"
+
+
+class OutputDiff(BaseModel):
+    """Where program output first diverged from the expected output."""
+    line: int = Field(..., description="1-based line of the first mismatch")
+    token: Optional[int] = Field(default=None, description="1-based token within the line, for token comparisons")
+    expected: Optional[str] = Field(default=None, description="Expected line or token; None if output was longer")
+    actual: Optional[str] = Field(default=None, description="Actual line or token; None if output ended early")
+    message: str
 
 
 class TestCase(BaseModel):
     input: str = Field(..., description="Input for the test case")
     expected_output: str = Field(..., description="Expected output")
+    compare_mode: Optional[CompareMode] = Field(
+        default=None, description="Output comparison; defaults to trim_trailing_whitespace (exact when strict)"
+    )
+    float_epsilon: float = Field(default=1e-6, gt=0, description="Allowed difference between numbers in float_tolerance mode")
     is_hidden: bool = Field(default=False, description="Whether this test case is hidden from students")
     weight: float = Field(default=1.0, ge=0, description="Weight of this test case in scoring")
     timeout: Optional[int] = Field(default=5, ge=1, le=30, description="Timeout in seconds")
@@ -31,15 +108,163 @@ class ResourceLimits(BaseModel):
 
 class CodeExecutionRequest(BaseModel):
     code: str = Field(..., min_length=1, max_length=50000, description="Code to execute")
-    language: Language = Field(..., description="Programming language")
+    language: str = Field(..., description="Programming language name, e.g. 'python'")
     test_cases: List[TestCase] = Field(..., min_items=1, max_items=20, description="Test cases to run")
     resource_limits: Optional[ResourceLimits] = Field(default_factory=ResourceLimits, description="Resource limits")
     compile_only: bool = Field(default=False, description="Only compile, don't execute")
 
 
+# Data files share the sandbox's memory limit, since they live on a tmpfs
+MAX_DATA_FILES_BYTES = 32 * 1024 * 1024
+
+# Uploaded binaries live on the workdir tmpfs, which shares the memory limit too
+MAX_BINARY_BYTES = 16 * 1024 * 1024
+
+
+class RunRequest(BaseModel):
+    # Data files may be binary; hashing the request dumps it to JSON
+    model_config = ConfigDict(ser_json_bytes="base64")
+
+    code: str = Field(default="", max_length=50000, description="Code to run; leave empty when sending files")
+    files: Optional[Dict[str, str]] = Field(
+        default=None, max_length=50,
+        description="Multi-file submission as relative path -> contents, written under /app/code"
+    )
+    entry_point: Optional[str] = Field(
+        default=None, description="File in files to compile/run; defaults to the language's source filename"
+    )
+    data_files: Optional[Dict[str, bytes]] = Field(
+        default=None, max_length=50,
+        description="Input files as relative path -> contents, readable by the program under /app/data but not writable"
+    )
+    filename: Optional[str] = Field(
+        default=None, max_length=100,
+        description="Name to save code under instead of the language default; must have the language's extension"
+    )
+    binary: Optional[Base64Bytes] = Field(
+        default=None,
+        description="Base64 precompiled executable to run instead of building code; only where binary uploads are allowed"
+    )
+    binary_arch: Optional[Architecture] = Field(
+        default=None, description="Architecture binary was built for; must match the executor's"
+    )
+    language: str = Field(..., description="Programming language name, e.g. 'python'")
+    version: Optional[str] = Field(default=None, description="Toolchain version, e.g. '1.22'; defaults to the language's default")
+    stdin: str = Field(default="", max_length=1024 * 1024, description="Data fed to the program's standard input")
+    timeout_ms: Optional[int] = Field(
+        default=None, ge=1, le=60000,
+        description="Wall-clock timeout; defaults to the language's configured timeout"
+    )
+    memory_limit_bytes: Optional[int] = Field(
+        default=None, ge=16 * 1024 * 1024, le=512 * 1024 * 1024,
+        description="Container memory limit; defaults to resource_limits.memory_mb"
+    )
+    cpu_quota: Optional[float] = Field(
+        default=None, gt=0, le=8,
+        description="CPU cores the program may use, like docker --cpus (0.5 = half a core); defaults to 1.0"
+    )
+    max_output_bytes: Optional[int] = Field(
+        default=None, ge=1, le=16 * 1024 * 1024,
+        description="Combined stdout and stderr kept before the program is killed; defaults to 64 KiB"
+    )
+    env: Optional[Dict[str, str]] = Field(
+        default=None, max_length=32,
+        description="Extra environment variables for build and run, merged onto the language defaults"
+    )
+    compile_args: Optional[List[str]] = Field(
+        default=None, max_length=16,
+        description="Extra compiler flags, e.g. ['-Wall', '-Werror']; each must be allowed by the language"
+    )
+    cacheable: bool = Field(
+        default=False,
+        description="Serve an identical earlier run's result from the cache; only for deterministic programs"
+    )
+    combined_output: bool = Field(
+        default=False,
+        description="Also return stdout and stderr interleaved in the order they were written, for legacy callers"
+    )
+    output_encoding: OutputEncoding = Field(
+        default=OutputEncoding.UTF8,
+        description="base64 also returns the program's exact output bytes in stdout_base64 and stderr_base64"
+    )
+    resource_limits: Optional[ResourceLimits] = Field(default_factory=ResourceLimits, description="Resource limits")
+
+    @field_validator("files")
+    @classmethod
+    def validate_files(cls, files):
+        if files is None:
+            return files
+        for path in files:
+            validate_submission_path(path)
+        if sum(len(content) for content in files.values()) > 50000:
+            raise ValueError("Files exceed 50000 characters in total")
+        return files
+
+    @field_validator("data_files")
+    @classmethod
+    def validate_data_files(cls, data_files):
+        if data_files is None:
+            return data_files
+        for path in data_files:
+            validate_submission_path(path)
+        if sum(len(content) for content in data_files.values()) > MAX_DATA_FILES_BYTES:
+            raise ValueError(f"Data files exceed {MAX_DATA_FILES_BYTES} bytes in total")
+        return data_files
+
+    @field_validator("binary")
+    @classmethod
+    def validate_binary(cls, binary):
+        if binary is not None and len(binary) > MAX_BINARY_BYTES:
+            raise ValueError(f"Binary exceeds {MAX_BINARY_BYTES} bytes")
+        return binary
+
+    @field_validator("filename")
+    @classmethod
+    def validate_filename(cls, filename):
+        if filename is not None and "/" in validate_submission_path(filename):
+            raise ValueError(f"Filename must not contain path separators: {filename!r}")
+        return filename
+
+    @field_validator("compile_args")
+    @classmethod
+    def validate_compile_args(cls, compile_args):
+        for arg in compile_args or []:
+            if not COMPILE_ARG_PATTERN.match(arg) or len(arg) > 100:
+                raise ValueError(f"Invalid compile argument: {arg!r}")
+        return compile_args
+
+    @field_validator("env")
+    @classmethod
+    def validate_env(cls, env):
+        for name, value in (env or {}).items():
+            validate_env_var(name, value)
+        return env
+
+    @model_validator(mode="after")
+    def validate_source(self):
+        if self.binary is not None:
+            if self.code or self.files:
+                raise ValueError("Provide either a binary or source, not both")
+            if self.binary_arch is None:
+                raise ValueError("binary_arch is required with a binary")
+            if self.filename or self.entry_point or self.compile_args:
+                raise ValueError("filename, entry_point and compile_args don't apply to binaries")
+            return self
+        if self.binary_arch is not None:
+            raise ValueError("binary_arch applies only with a binary")
+        if bool(self.code) == bool(self.files):
+            raise ValueError("Provide either code or files")
+        if self.filename is not None and self.files:
+            raise ValueError("filename applies to code submissions; use entry_point with files")
+        if self.entry_point is not None:
+            if not self.files or self.entry_point not in self.files:
+                raise ValueError(f"Entry point {self.entry_point!r} is not one of the submitted files")
+        return self
+
+
 class ValidationRequest(BaseModel):
     code: str = Field(..., min_length=1, max_length=50000, description="Code to validate")
-    language: Language = Field(..., description="Programming language")
+    language: str = Field(..., description="Programming language name, e.g. 'python'")
 
 
 class ExecutionStatus(str, Enum):
@@ -48,19 +273,161 @@ class ExecutionStatus(str, Enum):
     RUNTIME_ERROR = "runtime_error"
     TIMEOUT = "timeout"
     MEMORY_LIMIT_EXCEEDED = "memory_limit_exceeded"
+    OUTPUT_LIMIT_EXCEEDED = "output_limit_exceeded"
     SECURITY_VIOLATION = "security_violation"
+    INVALID_SUBMISSION = "invalid_submission"  # Rejected by validate(); the caller's fault, so never worth retrying
     INTERNAL_ERROR = "internal_error"
 
 
+class RunResult(BaseModel):
+    """Outcome of running a single submission, with compiler and program output kept apart."""
+    status: ExecutionStatus
+    stdout: str = ""
+    stderr: str = Field(default="", description="Program stderr, or compiler diagnostics on compilation_error")
+    exit_code: Optional[int] = None
+    signal: Optional[str] = Field(
+        default=None, description="Signal that killed the program on runtime_error, e.g. SIGSEGV; error_message says what it means"
+    )
+    duration_ms: int = Field(default=0, description="End-to-end time, including sandbox setup")
+    compile_duration_ms: int = Field(default=0, description="Time spent in the compile step; 0 for interpreted languages")
+    run_duration_ms: int = Field(default=0, description="Time spent running the program")
+    timed_out: bool = False
+    memory_used_bytes: Optional[int] = Field(
+        default=None, description="Peak memory of the sandbox during the run; None if it couldn't be measured"
+    )
+    error_message: Optional[str] = None
+    cached: bool = Field(default=False, description="Served from the result cache without running")
+    combined_output: Optional[str] = Field(
+        default=None,
+        description="stdout and stderr interleaved as written (compiler diagnostics on compilation_error); set when requested"
+    )
+    stdout_base64: Optional[str] = Field(
+        default=None, description="The program's exact stdout bytes, base64-encoded; set for output_encoding base64"
+    )
+    stderr_base64: Optional[str] = Field(
+        default=None, description="The program's exact stderr bytes, base64-encoded; set for output_encoding base64"
+    )
+
+    @property
+    def memory_used_mb(self) -> Optional[float]:
+        if self.memory_used_bytes is None:
+            return None
+        return self.memory_used_bytes / (1024 * 1024)
+
+
+class InteractiveResult(BaseModel):
+    """Outcome of an interactive submission, judged turn by turn."""
+    status: ExecutionStatus
+    accepted: bool = Field(default=False, description="The judge accepted the program's answers")
+    turns: int = Field(default=0, description="Lines the judge sent to the program")
+    stderr: str = Field(default="", description="Program stderr, or compiler diagnostics on compilation_error")
+    exit_code: Optional[int] = Field(default=None, description="None if the program was still running when the judge finished")
+    signal: Optional[str] = Field(default=None, description="Signal that killed the program on runtime_error, e.g. SIGSEGV")
+    duration_ms: int = 0
+    timed_out: bool = False
+    error_message: Optional[str] = None
+
+
+class OutputStream(str, Enum):
+    STDOUT = "stdout"
+    STDERR = "stderr"
+
+
+class OutputChunk(BaseModel):
+    """A piece of program output as it was produced."""
+    stream: OutputStream
+    data: str
+    timestamp: datetime
+
+
+class JobStatus(str, Enum):
+    PENDING = "pending"
+    RUNNING = "running"
+    COMPLETED = "completed"
+
+
+class ReplayBundle(BaseModel):
+    """A submission's full run spec, pinned to the exact image it ran on, for re-running it elsewhere."""
+    format_version: int = 1
+    request: RunRequest
+    image: str = Field(..., description="Executor image name the submission ran on")
+    image_digest: str = Field(..., description="Repo digest of that image, or its local image ID if it was never pushed")
+
+
+class JobResult(BaseModel):
+    """State of a queued submission; result is set once the job completes."""
+    job_id: str
+    status: JobStatus
+    result: Optional[RunResult] = None
+
+
+class StoredRunResult(BaseModel):
+    """A completed submission's result as persisted by a ResultStore."""
+    submission_id: str
+    language: str
+    user_id: Optional[int] = Field(default=None, description="Who submitted it; None for runs without a user")
+    created_at: datetime
+    result: RunResult
+
+
 class TestCaseResult(BaseModel):
     input: str
     expected_output: str
     actual_output: str
     status: ExecutionStatus
     execution_time_ms: int
-    memory_used_mb: float
+    memory_used_mb: Optional[float]
     passed: bool
     error_message: Optional[str] = None
+    diff: Optional[OutputDiff] = Field(default=None, description="First output mismatch, when the output was compared and differed")
+    run: Optional[RunResult] = Field(default=None, description="Full result of the run behind this test case")
+
+
+class VerdictStatus(str, Enum):
+    ACCEPTED = "accepted"
+    WRONG_ANSWER = "wrong_answer"
+    TIME_LIMIT_EXCEEDED = "time_limit_exceeded"
+    MEMORY_LIMIT_EXCEEDED = "memory_limit_exceeded"
+    OUTPUT_LIMIT_EXCEEDED = "output_limit_exceeded"
+    RUNTIME_ERROR = "runtime_error"
+    COMPILE_ERROR = "compile_error"
+    INTERNAL_ERROR = "internal_error"
+
+
+class Verdict(BaseModel):
+    """One overall grade for a submission's test case results."""
+    status: VerdictStatus
+    passed: int
+    total: int
+    first_failure: Optional[int] = Field(default=None, description="0-based index of the first failing test case")
+
+
+class BatchSubmission(RunRequest):
+    """One submission in a batch re-run, identified by the caller's submission ID."""
+    submission_id: str = Field(..., min_length=1, description="Caller's ID for the submission")
+
+
+class JobRequest(RunRequest):
+    """A submission queued through the async job API, optionally reporting back when it finishes."""
+    callback_url: Optional[HttpUrl] = Field(
+        default=None,
+        description="URL the finished job's JobCallback is POSTed to, signed with the X-CodeHub-Signature header"
+    )
+
+
+class JobCallback(BaseModel):
+    """Body POSTed to a job's callback_url once it completes."""
+    job_id: str
+    result: RunResult
+    verdict: Verdict
+
+
+class BatchResult(BaseModel):
+    """Per-submission test results of a batch; identical submissions share one execution."""
+    results: Dict[str, List[TestCaseResult]] = Field(default_factory=dict, description="Test results keyed by submission ID")
+    verdicts: Dict[str, Verdict] = Field(default_factory=dict, description="Overall verdict keyed by submission ID")
+    executions: int = Field(default=0, description="Distinct submissions actually run")
+    cache_hits: int = Field(default=0, description="Submissions answered from an identical one in the batch")
 
 
 class CompilationResult(BaseModel):
@@ -90,10 +457,44 @@ class ValidationResult(BaseModel):
     suggestions: List[str] = Field(default_factory=list)
 
 
+class DurationStats(BaseModel):
+    """Spread of one timing across a benchmark's iterations."""
+    min_ms: int
+    median_ms: int
+    p95_ms: int
+
+
+class BenchmarkReport(BaseModel):
+    """Executor overhead for one language, measured by running a trivial program repeatedly."""
+    language: str
+    iterations: int
+    image_pull_ms: int = Field(default=0, description="Time to pull the language's image; 0 if it was already present")
+    container_start: DurationStats = Field(..., description="Creating and starting a sandbox, with nothing run in it")
+    compile: Optional[DurationStats] = Field(default=None, description="Compile step; None for interpreted languages")
+    run: DurationStats = Field(..., description="Running the compiled or interpreted program")
+    cold_total: DurationStats = Field(..., description="End to end, in a container started for the run")
+    pooled_total: DurationStats = Field(..., description="End to end, in a warm pooled container")
+    pooled_saving_ms: int = Field(..., description="Median cold total minus median pooled total")
+
+
+class LanguageLimits(BaseModel):
+    """A language's default limits, used for submissions that don't set their own."""
+    memory_limit_bytes: Optional[int] = Field(
+        default=None, ge=16 * 1024 * 1024, le=512 * 1024 * 1024,
+        description="Container memory limit; None uses resource_limits.memory_mb"
+    )
+    cpu_quota: Optional[float] = Field(
+        default=None, gt=0, le=8,
+        description="CPU cores, like docker --cpus; None uses 1.0"
+    )
+    timeout_ms: int = Field(..., ge=1, le=60000, description="Wall-clock timeout")
+
+
 class LanguageInfo(BaseModel):
     name: str
     version: str
     file_extension: str
     compile_command: Optional[str] = None
     run_command: str
-    supported_features: List[str] = Field(default_factory=list)
\ No newline at end of file
+    supported_features: List[str] = Field(default_factory=list)
+    limits: Optional[LanguageLimits] = None
\ No newline at end of file
@@ -1,127 +1,380 @@
 import asyncio
+import base64
+import codecs
+import concurrent.futures
 import json
 import logging
 import os
+import posixpath
 import tempfile
 import time
 import uuid
+from contextlib import asynccontextmanager
+from contextvars import ContextVar
+from dataclasses import replace
+from datetime import datetime, timezone
 from pathlib import Path
-from typing import Dict, List, Optional
+from typing import AsyncIterator, Callable, Dict, List, Optional, Tuple, TypeVar
 
 import docker
 from docker.errors import ContainerError, ImageNotFound
 
 from app.schemas.execution import (
+    Architecture,
     CodeExecutionRequest,
+    CompareMode,
     ExecutionResult,
     ExecutionStatus,
     Language,
     LanguageInfo,
+    LanguageLimits,
     TestCase,
     TestCaseResult,
     ValidationRequest,
     ValidationResult,
     CompilationResult,
-    ResourceLimits
+    ResourceLimits,
+    OutputChunk,
+    OutputEncoding,
+    OutputStream,
+    RunRequest,
+    RunResult,
+    validate_env_var,
+    validate_submission_path
 )
+from app.core.execution_languages import (
+    InvalidFilenameError,
+    InvalidSubmissionError,
+    LanguageConfig,
+    UnsupportedLanguageError,
+    get_language_config,
+    registered_languages,
+    set_language_limits,
+    validate_compile_args,
+    validate_source_filename,
+)
+from app.core.config import settings
+from app.services.execution_binary import elf_architecture, host_architecture
+from app.services.execution_cache import ResultCache
+from app.services.execution_compare import compare_output
+from app.services.execution_logging import (
+    COMPILE_FINISHED,
+    COMPILE_STARTED,
+    RUN_FINISHED,
+    RUN_STARTED,
+    SANDBOX_CLEANED_UP,
+    SANDBOX_CREATED,
+    SubmissionLogger,
+)
+from app.services.execution_metrics import ExecutionMetrics, execution_metrics
+from app.services.execution_pool import ContainerPool
+from app.services.execution_sandbox import (
+    DEFAULT_SECCOMP_PROFILE,
+    EXECUTION_LABEL,
+    JOB_ID_LABEL,
+    SNAPSHOT_DIR,
+    CombinedOutput,
+    ExecOutput,
+    Sandbox,
+    load_seccomp_profile,
+)
+from app.services.execution_signals import exit_signal, signal_reason
 # from app.core.execution_security import ExecutionSecurityConfig, ExecutionSecurityMiddleware, SecurityLevel
 
 logger = logging.getLogger(__name__)
 
+# Processes the sandbox itself needs on top of the submission's own limit
+SANDBOX_PROCESS_OVERHEAD = 3
+
+# Ceiling on a sandbox's cgroup pids limit; covers the JVM's threads with room to spare
+DEFAULT_PIDS_LIMIT = 64
+
+# Host-side slack on top of the in-container timeout before the sandbox is killed
+EXECUTION_DEADLINE_GRACE_SECONDS = 2
+
+# Time a timed-out program gets between SIGTERM and SIGKILL to flush output and clean up
+DEFAULT_KILL_GRACE_SECONDS = 2.0
+
+# Job ID of the submission being run, set by the scheduler and used to label its containers
+current_job_id: ContextVar[Optional[str]] = ContextVar("current_job_id", default=None)
+
+# CPU cores a sandbox may use when the submission doesn't set cpu_quota
+DEFAULT_CPU_QUOTA = 1.0
+CPU_PERIOD_US = 100000
+
+# Combined stdout+stderr kept per exec when the caller doesn't specify a limit
+DEFAULT_MAX_OUTPUT_BYTES = 64 * 1024
+
+# How long a streaming run waits for the consumer to make room for a chunk
+STREAM_SEND_TIMEOUT_SECONDS = 10
+
+# Highest per-submission limits validate() accepts by default, keyed by RunRequest field;
+# also the schema's own bounds, so configured caps can only lower them
+MAX_SUBMISSION_LIMITS = {
+    "timeout_ms": 60000,
+    "memory_limit_bytes": 512 * 1024 * 1024,
+    "cpu_quota": 8,
+    "max_output_bytes": 16 * 1024 * 1024,
+}
+
+
+class ExecutionUnavailableError(Exception):
+    """Raised by healthcheck() when submissions can't currently be executed."""
+
+
+class EmptySourceError(InvalidSubmissionError):
+    """Raised when a submission has no code to run."""
+
+
+class BinaryUploadDisabledError(InvalidSubmissionError):
+    """Raised when a submission sends a binary but the service doesn't accept them."""
+
+
+class InvalidBinaryError(InvalidSubmissionError):
+    """Raised when an uploaded binary isn't an executable this service can run."""
+
+
+class LimitTooHighError(InvalidSubmissionError):
+    """Raised when a submission asks for more resources than the service allows."""
+
+    def __init__(self, field: str, value, limit):
+        self.field = field
+        self.value = value
+        self.limit = limit
+        super().__init__(f"{field} {value} exceeds the maximum of {limit}")
+
+
+T = TypeVar("T")
+
+
+async def _off_loop(do: Callable[[], T], undo: Callable[[T], None]) -> T:
+    """
+    Run a blocking sandbox call in a worker thread so it never stalls the event loop.
+    
+    The thread can't be interrupted, so if the caller is cancelled first (say by
+    shutdown), undo() is run on whatever do() returns once it finishes.
+    """
+    loop = asyncio.get_running_loop()
+    done = asyncio.ensure_future(asyncio.to_thread(do))
+    try:
+        return await asyncio.shield(done)
+    except asyncio.CancelledError:
+        def abandoned(future: asyncio.Future) -> None:
+            if not future.cancelled() and future.exception() is None:
+                loop.run_in_executor(None, undo, future.result())
+        done.add_done_callback(abandoned)
+        raise
+
 print("DEBUG: About to define CodeExecutionService class")
 
 class CodeExecutionService:
     """Secure code execution service using Docker containers."""
     
-    def __init__(self):
+    def __init__(
+        self,
+        pool_size: int = 0,
+        allow_network: bool = False,
+        read_only_root_fs: bool = True,
+        pids_limit: int = DEFAULT_PIDS_LIMIT,
+        seccomp_profile: Optional[str] = DEFAULT_SECCOMP_PROFILE,
+        kill_grace_seconds: float = DEFAULT_KILL_GRACE_SECONDS,
+        pull_images: bool = True,
+        docker_retry_attempts: int = 3,
+        result_cache: Optional[ResultCache] = None,
+        max_limits: Optional[Dict[str, float]] = None,
+        allow_binary_upload: bool = False,
+        architecture: Optional[Architecture] = None,
+        logger: Optional[logging.Logger] = None,
+        metrics: Optional[ExecutionMetrics] = None
+    ):
+        # Per-submission logs go here, each line tagged with the submission ID and language
+        self.logger = logger or logging.getLogger(__name__)
+        self.metrics = metrics or execution_metrics
+        
         try:
             self.docker_client = docker.from_env()
         except Exception as e:
-            logger.warning(f"Docker client initialization failed: {e}")
+            self.logger.warning(f"Docker client initialization failed: {e}")
             self.docker_client = None
         
-        self.language_configs = self._get_language_configs()
+        # Sandboxes get no network namespace at all unless explicitly allowed
+        self.allow_network = allow_network
+        
+        # Submissions and their build artifacts live on tmpfs mounts; the image itself can't be modified
+        self.read_only_root_fs = read_only_root_fs
+        
+        # nproc ulimits count every container's processes for the shared UID; the cgroup limit is per sandbox
+        self.pids_limit = pids_limit
+        
+        # Path to a seccomp JSON profile applied to every sandbox; None leaves Docker's default filter
+        self.seccomp_profile = load_seccomp_profile(seccomp_profile) if seccomp_profile else None
+        
+        # Timed-out programs get SIGTERM first and SIGKILL only this long after, like docker stop
+        self.kill_grace_seconds = kill_grace_seconds
+        
+        # Air-gapped hosts have images pre-loaded and must not try to pull
+        self.pull_images = pull_images
+        
+        # Tries per container start when the daemon fails transiently
+        self.docker_retry_attempts = docker_retry_attempts
+        
+        # Only consulted for requests that opt in with cacheable
+        self.result_cache = result_cache
+        
+        # Caps on what a submission may ask for, so one request can't take the whole host
+        self.max_limits = dict(MAX_SUBMISSION_LIMITS)
+        for field, limit in (max_limits or {}).items():
+            if field not in MAX_SUBMISSION_LIMITS:
+                raise ValueError(f"Unknown submission limit: {field}")
+            if not 0 < limit <= MAX_SUBMISSION_LIMITS[field]:
+                raise ValueError(f"Maximum {field} must be between 0 and {MAX_SUBMISSION_LIMITS[field]}, got {limit}")
+            self.max_limits[field] = limit
+        
+        # Precompiled binaries skip the build and any review of their source; off unless a deployment opts in
+        self.allow_binary_upload = allow_binary_upload
+        self.architecture = architecture or host_architecture()
+        
+        # Warm containers are only handed out for runs with the default limits
+        self.pool = None
+        if pool_size > 0:
+            self.pool = ContainerPool(
+                pool_size,
+                lambda language: self._create_sandbox(
+                    get_language_config(language), ResourceLimits(), job_id="pool"
+                )
+            )
+        
         # self.security_middleware = ExecutionSecurityMiddleware(SecurityLevel.HIGH)
         # self.security_config = ExecutionSecurityConfig()
         
         if self.docker_client:
-            self._ensure_images_exist()
+            try:
+                self.ensure_images()
+            except ExecutionUnavailableError as e:
+                # Keep serving; /healthz reports the missing image until it's fixed
+                self.logger.error(str(e))
+            self.cleanup_orphans()
+            self._warm_pool()
+    
+    @property
+    def language_configs(self) -> Dict[str, LanguageConfig]:
+        """Currently registered languages, including ones added at runtime."""
+        return self._get_language_configs()
     
-    def _get_language_configs(self) -> Dict[Language, Dict]:
+    def _get_language_configs(self) -> Dict[str, LanguageConfig]:
         """Get configuration for each supported language."""
-        return {
-            Language.PYTHON: {
-                "image": "assessment-python-executor",
-                "dockerfile": "backend/docker/execution/Dockerfile.python",
-                "file_extension": ".py",
-                "compile_command": None,
-                "run_command": "python3 {filename}",
-                "version_command": "python3 --version"
-            },
-            Language.JAVASCRIPT: {
-                "image": "assessment-js-executor",
-                "dockerfile": "backend/docker/execution/Dockerfile.javascript",
-                "file_extension": ".js",
-                "compile_command": None,
-                "run_command": "node {filename}",
-                "version_command": "node --version"
-            },
-            Language.JAVA: {
-                "image": "assessment-java-executor",
-                "dockerfile": "backend/docker/execution/Dockerfile.java",
-                "file_extension": ".java",
-                "compile_command": "javac {filename}",
-                "run_command": "java {classname}",
-                "version_command": "java --version"
-            },
-            Language.CPP: {
-                "image": "assessment-cpp-executor",
-                "dockerfile": "backend/docker/execution/Dockerfile.cpp",
-                "file_extension": ".cpp",
-                "compile_command": "g++ -o {output} {filename} -std=c++17 -Wall",
-                "run_command": "./{output}",
-                "version_command": "g++ --version"
-            },
-            Language.CSHARP: {
-                "image": "assessment-csharp-executor",
-                "dockerfile": "backend/docker/execution/Dockerfile.csharp",
-                "file_extension": ".cs",
-                "compile_command": "dotnet build -o /tmp/output",
-                "run_command": "dotnet /tmp/output/program.dll",
-                "version_command": "dotnet --version"
-            },
-            Language.GO: {
-                "image": "assessment-go-executor",
-                "dockerfile": "backend/docker/execution/Dockerfile.go",
-                "file_extension": ".go",
-                "compile_command": "go build -o {output} {filename}",
-                "run_command": "./{output}",
-                "version_command": "go version"
-            },
-            Language.RUST: {
-                "image": "assessment-rust-executor",
-                "dockerfile": "backend/docker/execution/Dockerfile.rust",
-                "file_extension": ".rs",
-                "compile_command": "rustc {filename} -o {output}",
-                "run_command": "./{output}",
-                "version_command": "rustc --version"
-            }
-        }
+        return registered_languages()
     
-    def _ensure_images_exist(self):
-        """Ensure all Docker images are built."""
+    def _warm_pool(self):
+        """Pre-start idle containers for every registered language."""
+        if self.pool is None:
+            return
+        try:
+            self.pool.warm(list(self.language_configs))
+        except Exception as e:
+            logger.warning(f"Failed to warm container pool: {e}")
+    
+    def ensure_images(self):
+        """
+        Make sure every executor image is available locally before it's needed.
+        
+        Images already present are left alone, so this is cheap to call again.
+        Missing ones are pulled with progress logged, unless pull_images is off,
+        in which case they're expected to be pre-loaded. Raises
+        ExecutionUnavailableError on the first image that can't be obtained.
+        """
         if not self.docker_client:
             logger.warning("Docker client not available, skipping image check")
             return
+        
+        for image in self._images():
+            try:
+                self.docker_client.images.get(image)
+                logger.info(f"Docker image {image} exists")
+                continue
+            except ImageNotFound:
+                pass
+            except Exception as e:
+                raise ExecutionUnavailableError(f"Error checking image {image}: {e}")
             
-        for language, config in self.language_configs.items():
+            if not self.pull_images:
+                raise ExecutionUnavailableError(
+                    f"Docker image {image} not found and image pulling is disabled. Please load it first."
+                )
+            self._pull_image(image)
+    
+    def _pull_image(self, image: str):
+        repository, tag = image, "latest"
+        name, _, maybe_tag = image.rpartition(":")
+        if name and "/" not in maybe_tag:
+            repository, tag = name, maybe_tag
+        
+        logger.info(f"Pulling Docker image {repository}:{tag}...")
+        try:
+            for event in self.docker_client.api.pull(repository, tag=tag, stream=True, decode=True):
+                if "error" in event:
+                    raise ExecutionUnavailableError(f"Failed to pull Docker image {image}: {event['error']}")
+                status = event.get("status")
+                # Per-chunk Downloading/Extracting events are too chatty to log
+                if not status or status in ("Downloading", "Extracting"):
+                    continue
+                layer = event.get("id")
+                logger.info(f"{image}: {layer} {status}" if layer else f"{image}: {status}")
+        except ExecutionUnavailableError:
+            raise
+        except Exception as e:
+            raise ExecutionUnavailableError(f"Failed to pull Docker image {image}: {e}")
+        logger.info(f"Pulled Docker image {image}")
+    
+    def _images(self) -> Dict[str, LanguageConfig]:
+        """Every executor image keyed by tag, including pinned version variants."""
+        images = {}
+        for name, config in self.language_configs.items():
+            images.setdefault(config.image, config)
+            for version in config.versions:
+                variant = get_language_config(name, version)
+                images.setdefault(variant.image, variant)
+        return images
+    
+    def healthcheck(self):
+        """
+        Check that code can actually be executed right now.
+        
+        Pings the Docker daemon and confirms every executor image is present
+        locally or pullable from a registry. Raises ExecutionUnavailableError
+        describing the first problem found.
+        """
+        if not self.docker_client:
+            # The daemon may not have been configured yet when the service started
+            try:
+                self.docker_client = docker.from_env()
+            except Exception as e:
+                raise ExecutionUnavailableError(f"Docker client unavailable: {e}")
+            self.cleanup_orphans()
+            self._warm_pool()
+        
+        try:
+            self.docker_client.ping()
+        except Exception as e:
+            raise ExecutionUnavailableError(f"Docker daemon is not responding: {e}")
+        
+        missing = []
+        for image in self._images():
             try:
-                self.docker_client.images.get(config["image"])
-                logger.info(f"Docker image {config['image']} exists")
+                self.docker_client.images.get(image)
+                continue
             except ImageNotFound:
-                logger.warning(f"Docker image {config['image']} not found. Please build it first.")
+                pass
             except Exception as e:
-                logger.warning(f"Error checking image {config['image']}: {e}")
+                raise ExecutionUnavailableError(f"Error checking image {image}: {e}")
+            try:
+                self.docker_client.images.get_registry_data(image)
+            except Exception:
+                missing.append(image)
+        if missing:
+            raise ExecutionUnavailableError(
+                f"Executor images not found locally or in a registry: {', '.join(sorted(missing))}"
+            )
     
     async def execute_code(self, request: CodeExecutionRequest) -> ExecutionResult:
         """Execute code with test cases in a secure container."""
@@ -129,7 +382,9 @@ class CodeExecutionService:
         
         try:
             # Validate language support
-            if request.language not in self.language_configs:
+            try:
+                config = get_language_config(request.language)
+            except UnsupportedLanguageError as e:
                 return ExecutionResult(
                     status=ExecutionStatus.INTERNAL_ERROR,
                     total_execution_time_ms=0,
@@ -137,7 +392,7 @@ class CodeExecutionService:
                     passed_tests=0,
                     total_tests=len(request.test_cases),
                     score=0.0,
-                    error_message=f"Unsupported language: {request.language}"
+                    error_message=str(e)
                 )
             
             # TODO: Apply security validation
@@ -145,11 +400,9 @@ class CodeExecutionService:
             #     request.code, request.language, request.test_cases
             # )
             
-            config = self.language_configs[request.language]
-            
             # Compile code if needed
             compilation_result = None
-            if config["compile_command"]:
+            if config.is_compiled:
                 compilation_result = await self._compile_code(request.code, request.language, config)
                 if not compilation_result.success:
                     return ExecutionResult(
@@ -177,7 +430,7 @@ class CodeExecutionService:
                     request.resource_limits
                 )
                 test_results.append(result)
-                total_memory += result.memory_used_mb
+                total_memory += result.memory_used_mb or 0
                 if result.passed:
                     passed_tests += 1
             
@@ -196,6 +449,8 @@ class CodeExecutionService:
                 status = ExecutionStatus.TIMEOUT
             elif any(result.status == ExecutionStatus.MEMORY_LIMIT_EXCEEDED for result in test_results):
                 status = ExecutionStatus.MEMORY_LIMIT_EXCEEDED
+            elif any(result.status == ExecutionStatus.OUTPUT_LIMIT_EXCEEDED for result in test_results):
+                status = ExecutionStatus.OUTPUT_LIMIT_EXCEEDED
             elif any(result.status == ExecutionStatus.SECURITY_VIOLATION for result in test_results):
                 status = ExecutionStatus.SECURITY_VIOLATION
             else:
@@ -224,81 +479,874 @@ class CodeExecutionService:
                 error_message=f"Internal error: {str(e)}"
             )
     
-    async def _compile_code(self, code: str, language: Language, config: Dict) -> CompilationResult:
-        """Compile code if compilation is required."""
-        execution_id = str(uuid.uuid4())
+    def validate(self, request: RunRequest) -> LanguageConfig:
+        """
+        Check a submission without touching Docker, returning its language config.
+        
+        Raises UnsupportedLanguageError for unregistered languages or versions,
+        EmptySourceError for blank code, InvalidFilenameError for paths outside
+        the workdir or with the wrong extension, InvalidCompileArgError for
+        compiler flags the language doesn't allow, BinaryUploadDisabledError
+        or InvalidBinaryError for binaries that can't be run here and
+        LimitTooHighError for limits above max_limits; all are
+        InvalidSubmissionErrors.
+        The schema checks some of this already, but requests can be built
+        without it.
+        """
+        config = get_language_config(request.language, request.version)
+        
+        if request.binary is not None:
+            self._validate_binary(request, config)
+        else:
+            sources = request.files.values() if request.files else [request.code]
+            if not any(source.strip() for source in sources):
+                raise EmptySourceError("Source code is empty")
+        
+        paths = [
+            *(request.files or {}), *(request.data_files or {}),
+            *filter(None, [request.entry_point, request.filename])
+        ]
+        for path in paths:
+            try:
+                validate_submission_path(path)
+            except ValueError as e:
+                raise InvalidFilenameError(str(e)) from None
+        if request.filename:
+            if "/" in request.filename:
+                raise InvalidFilenameError(f"Filename must not contain path separators: {request.filename!r}")
+            validate_source_filename(config, request.filename)
+        validate_compile_args(config, request.compile_args or [])
+        
+        for field, limit in self.max_limits.items():
+            value = getattr(request, field)
+            if value is not None and value > limit:
+                raise LimitTooHighError(field, value, limit)
+        return config
+    
+    def _validate_binary(self, request: RunRequest, config: LanguageConfig):
+        if not self.allow_binary_upload:
+            raise BinaryUploadDisabledError("Binary uploads are not enabled on this server")
+        if not config.accepts_binary:
+            raise InvalidBinaryError(f"{getattr(request.language, 'value', request.language)} doesn't accept binaries")
+        built_for = elf_architecture(request.binary)
+        if built_for is None:
+            raise InvalidBinaryError("Binary is not an ELF executable for a supported architecture")
+        if built_for != request.binary_arch:
+            raise InvalidBinaryError(f"Binary was built for {built_for.value}, not {request.binary_arch.value}")
+        if built_for != self.architecture:
+            raise InvalidBinaryError(
+                f"Binary was built for {built_for.value}, but sandboxes run on "
+                f"{self.architecture.value if self.architecture else 'an unknown architecture'}"
+            )
+    
+    async def run_code(self, request: RunRequest) -> RunResult:
+        """
+        Compile (if needed) and run a single submission, returning structured output.
+        
+        Cacheable requests are answered from the result cache when an
+        identical one ran recently, without touching Docker.
+        """
+        cache = self.result_cache if request.cacheable else None
+        if cache is not None:
+            resolved = await self._cache_context(request)
+            cached = cache.get(request, resolved)
+            if cached is not None:
+                return cached
+        result = await self._run_request(request)
+        self.metrics.record_run(request.language, result)
+        if cache is not None:
+            cache.put(request, result, resolved)
+        return result
+    
+    async def _cache_context(self, request: RunRequest) -> Optional[dict]:
+        """
+        The limits a request resolves to and the ID of the image it runs on.
         
+        Requests that leave limits to the language defaults don't carry them,
+        and the defaults can change, as can the image when it's rebuilt, so
+        cached results are keyed by these too. None for requests validate()
+        rejects, which never get as far as either.
+        """
         try:
-            with tempfile.TemporaryDirectory() as temp_dir:
-                # Write code to file
-                filename = f"code{config['file_extension']}"
-                code_path = Path(temp_dir) / filename
-                code_path.write_text(code)
-                
-                # Prepare compilation command
-                compile_cmd = config["compile_command"]
-                if language == Language.JAVA:
-                    # Extract class name for Java
-                    class_name = self._extract_java_class_name(code)
-                    if not class_name:
-                        return CompilationResult(
-                            success=False,
-                            output="",
-                            error_message="No public class found in Java code"
-                        )
-                    filename = f"{class_name}.java"
-                    code_path = Path(temp_dir) / filename
-                    code_path.write_text(code)
-                    compile_cmd = compile_cmd.format(filename=filename)
-                else:
-                    output_name = "program"
-                    compile_cmd = compile_cmd.format(
-                        filename=filename,
-                        output=output_name
-                    )
-                
-                # Run compilation in container
-                container = self.docker_client.containers.run(
-                    config["image"],
-                    command=f"sh -c 'echo \"{code}\" > {filename} && {compile_cmd}'",
-                    detach=True,
-                    mem_limit="256m",
-                    cpu_period=100000,
-                    cpu_quota=50000,  # 50% CPU
-                    network_disabled=True,
-                    read_only=True,
-                    tmpfs={"/tmp": "size=100m,noexec"},
-                    user="coderunner"
+            config = self.validate(request)
+        except InvalidSubmissionError:
+            return None
+        return {
+            "timeout_seconds": self._timeout_for(request, config),
+            "memory_limit_bytes": self._memory_limit_for(config, request.resource_limits, request.memory_limit_bytes),
+            "cpu_quota": self._cpu_quota_for(config, request.cpu_quota),
+            "max_output_bytes": self._max_output_for(request),
+            "image_id": await asyncio.to_thread(self._image_id, config.image)
+        }
+    
+    def _image_id(self, image: str) -> Optional[str]:
+        """ID of a local image, which changes when it's rebuilt; None if it can't be looked up."""
+        try:
+            return self.docker_client.images.get(image).id
+        except Exception:
+            return None
+    
+    async def run_code_stream(self, request: RunRequest, out: asyncio.Queue) -> RunResult:
+        """
+        Run a submission, putting OutputChunks on out as the program produces them.
+        
+        None is put on out once the program exits; the full result is returned.
+        If the consumer stops reading and out stays full, the run is aborted and
+        its sandbox removed.
+        """
+        loop = asyncio.get_running_loop()
+        decoders = {}
+        
+        def forward(stream: str, data: bytes):
+            # Incremental decoding so multi-byte characters can span chunks
+            decoder = decoders.setdefault(stream, codecs.getincrementaldecoder("utf-8")(errors="replace"))
+            chunk = OutputChunk(
+                stream=OutputStream(stream),
+                data=decoder.decode(data),
+                timestamp=datetime.now(timezone.utc)
+            )
+            sent = asyncio.run_coroutine_threadsafe(out.put(chunk), loop)
+            try:
+                sent.result(STREAM_SEND_TIMEOUT_SECONDS)
+            except concurrent.futures.TimeoutError:
+                sent.cancel()
+                raise RuntimeError("Output stream consumer stopped reading") from None
+        
+        try:
+            result = await self._run_request(request, on_output=forward)
+            self.metrics.record_run(request.language, result)
+            return result
+        finally:
+            try:
+                out.put_nowait(None)
+            except asyncio.QueueFull:
+                pass
+    
+    async def _run_request(
+        self,
+        request: RunRequest,
+        on_output: Optional[Callable[[str, bytes], None]] = None,
+        image: Optional[str] = None
+    ) -> RunResult:
+        log = self._submission_logger(request.language)
+        try:
+            config = self.validate(request)
+            if image:
+                # Pinned by a replay; never matches the pool's images
+                config = replace(config, image=image)
+        except (EmptySourceError, InvalidFilenameError) as e:
+            # Reported like the compiler would have, without starting a sandbox
+            return RunResult(status=ExecutionStatus.COMPILATION_ERROR, error_message=str(e))
+        except InvalidSubmissionError as e:
+            return RunResult(status=ExecutionStatus.INVALID_SUBMISSION, error_message=str(e))
+        
+        combined = CombinedOutput(forward=on_output) if request.combined_output else None
+        if combined is not None:
+            on_output = combined.write
+        try:
+            result = await self._run_submission(
+                request.code, request.language, config, request.stdin, request.resource_limits,
+                timeout_seconds=self._timeout_for(request, config),
+                memory_limit_bytes=request.memory_limit_bytes,
+                cpu_quota=request.cpu_quota,
+                max_output_bytes=self._max_output_for(request),
+                files=request.files,
+                entry_point=request.entry_point,
+                filename=request.filename,
+                env=request.env,
+                compile_args=request.compile_args,
+                data_files=request.data_files,
+                binary=request.binary,
+                output_encoding=request.output_encoding,
+                on_output=on_output,
+                log=log
+            )
+        except Exception as e:
+            log.error(f"Code execution failed: {str(e)}")
+            return RunResult(
+                status=ExecutionStatus.INTERNAL_ERROR,
+                error_message=f"Internal error: {str(e)}"
+            )
+        if combined is not None:
+            # Nothing was run when compilation failed; its diagnostics are the whole output
+            result.combined_output = combined.text() or result.stderr
+        return result
+    
+    async def run_test_cases(
+        self,
+        request: RunRequest,
+        test_cases: List[TestCase],
+        strict: bool = False
+    ) -> List[TestCaseResult]:
+        """
+        Run a submission against each test case and compare its output.
+        
+        Each case's input replaces request.stdin and its output is compared
+        using the case's compare_mode (exact when strict, if unset). A case
+        that times out or crashes is recorded as failed and the remaining
+        cases still run. Compiled languages are built once for all the cases;
+        see _run_built_test_cases. Raises InvalidSubmissionError if validate()
+        rejects the submission.
+        """
+        config = self.validate(request)
+        timeout_seconds = self._timeout_for(request, config)
+        log = self._submission_logger(request.language)
+        if config.is_compiled and test_cases:
+            return await self._run_built_test_cases(request, test_cases, config, timeout_seconds, strict, log)
+        
+        results = []
+        for test_case in test_cases:
+            results.append(await self._execute_test_case(
+                request.code,
+                request.language,
+                test_case,
+                config,
+                request.resource_limits,
+                strict=strict,
+                timeout_seconds=timeout_seconds,
+                memory_limit_bytes=request.memory_limit_bytes,
+                cpu_quota=request.cpu_quota,
+                max_output_bytes=self._max_output_for(request),
+                files=request.files,
+                entry_point=request.entry_point,
+                filename=request.filename,
+                env=request.env,
+                compile_args=request.compile_args,
+                data_files=request.data_files,
+                log=log
+            ))
+        return results
+    
+    async def _run_built_test_cases(
+        self,
+        request: RunRequest,
+        test_cases: List[TestCase],
+        config: LanguageConfig,
+        timeout_seconds: float,
+        strict: bool,
+        log: SubmissionLogger
+    ) -> List[TestCaseResult]:
+        """
+        Compile once and run every test case against the same build.
+        
+        The cases share a sandbox, whose workdir is put back to its state
+        right after the build before each case, with anything the previous
+        case left running killed. A failed build fails every case with the
+        compiler's output. A case that gets the sandbox killed (output limit,
+        or the host deadline) leaves the rest to a fresh sandbox and build.
+        """
+        filename, template_args, error = self._resolve_source(
+            request.code, request.language, config, request.files, request.entry_point, request.filename,
+            binary=request.binary
+        )
+        if error:
+            failed = RunResult(status=ExecutionStatus.COMPILATION_ERROR, stderr=error, error_message=error)
+            self.metrics.record_run(request.language, failed)
+            return [self._grade_test_case(test_case, failed, strict) for test_case in test_cases]
+        source_files = self._source_files(request.code, filename, config, request.files)
+        environment = self._submission_env(config, request.env)
+        
+        results = []
+        remaining = list(test_cases)
+        while remaining:
+            start_time = time.time()
+            async with self._sandbox_for(
+                request.language, config, request.resource_limits, request.memory_limit_bytes,
+                request.cpu_quota, log=log, allow_pool=not request.data_files
+            ) as sandbox:
+                if request.data_files:
+                    await asyncio.to_thread(sandbox.write_data_files, request.data_files)
+                failed, compile_ms = await self._compile_in(
+                    sandbox, config, template_args, source_files, environment,
+                    request.compile_args, self._max_output_for(request), log, start_time, binary=request.binary
                 )
+                if failed is not None:
+                    self.metrics.record_run(request.language, failed)
+                    return results + [self._grade_test_case(test_case, failed, strict) for test_case in remaining]
+                await asyncio.to_thread(sandbox.snapshot_workdir)
+                await asyncio.to_thread(sandbox.reset_memory_peak)
                 
-                # Wait for compilation with timeout
-                try:
-                    result = container.wait(timeout=30)
-                    logs = container.logs().decode('utf-8')
-                    
-                    if result['StatusCode'] == 0:
-                        return CompilationResult(
-                            success=True,
-                            output=logs
-                        )
-                    else:
-                        return CompilationResult(
-                            success=False,
-                            output=logs,
-                            error_message="Compilation failed"
-                        )
-                        
-                except Exception as e:
-                    return CompilationResult(
-                        success=False,
-                        output="",
-                        error_message=f"Compilation timeout or error: {str(e)}"
+                fresh_build = True
+                while remaining and not sandbox.killed:
+                    if not fresh_build:
+                        start_time = time.time()
+                        await asyncio.to_thread(sandbox.restore_workdir)
+                        await asyncio.to_thread(sandbox.record_memory_baseline)
+                        await asyncio.to_thread(sandbox.reset_memory_peak)
+                    test_case = remaining.pop(0)
+                    # Only the first case after a build carries its compile time, so it's counted once
+                    run = await self._run_in(
+                        sandbox, request.code, filename, config, template_args, source_files, test_case.input,
+                        request.resource_limits, timeout_seconds, self._max_output_for(request), environment,
+                        None, log, start_time, compile_ms if fresh_build else 0,
+                        output_encoding=request.output_encoding
                     )
-                finally:
-                    try:
-                        container.remove(force=True)
-                    except:
-                        pass
+                    fresh_build = False
+                    self.metrics.record_run(request.language, run)
+                    results.append(self._grade_test_case(test_case, run, strict))
+                if not sandbox.killed:
+                    await asyncio.to_thread(sandbox.discard_snapshot)
+        return results
+    
+    def _timeout_for(self, request: RunRequest, config: LanguageConfig) -> float:
+        """Per-submission override, otherwise whatever the language config specifies, within the cap."""
+        if request.timeout_ms:
+            return request.timeout_ms / 1000
+        return min(config.default_timeout, self.max_limits["timeout_ms"] / 1000)
+    
+    def _max_output_for(self, request: RunRequest) -> int:
+        """Per-submission override, otherwise the default output cap, within the cap."""
+        return request.max_output_bytes or min(DEFAULT_MAX_OUTPUT_BYTES, self.max_limits["max_output_bytes"])
+    
+    def _submission_logger(self, language: str) -> SubmissionLogger:
+        """Logger for one submission, keyed by the scheduler's job ID when there is one."""
+        submission_id = current_job_id.get() or uuid.uuid4().hex
+        return SubmissionLogger(self.logger, submission_id, getattr(language, "value", language))
+    
+    async def _run_submission(
+        self,
+        code: str,
+        language: str,
+        config: LanguageConfig,
+        stdin: str,
+        resource_limits: ResourceLimits,
+        timeout_seconds: Optional[float] = None,
+        memory_limit_bytes: Optional[int] = None,
+        cpu_quota: Optional[float] = None,
+        max_output_bytes: int = DEFAULT_MAX_OUTPUT_BYTES,
+        files: Optional[Dict[str, str]] = None,
+        entry_point: Optional[str] = None,
+        filename: Optional[str] = None,
+        env: Optional[Dict[str, str]] = None,
+        compile_args: Optional[List[str]] = None,
+        data_files: Optional[Dict[str, bytes]] = None,
+        binary: Optional[bytes] = None,
+        output_encoding: OutputEncoding = OutputEncoding.UTF8,
+        on_output: Optional[Callable[[str, bytes], None]] = None,
+        log: Optional[SubmissionLogger] = None
+    ) -> RunResult:
+        """Run one submission in its own sandbox; infrastructure errors propagate."""
+        start_time = time.time()
+        log = log or self._submission_logger(language)
+        if timeout_seconds is None:
+            timeout_seconds = resource_limits.wall_time_seconds
+        
+        filename, template_args, error = self._resolve_source(
+            code, language, config, files, entry_point, filename, binary=binary
+        )
+        if error:
+            return RunResult(
+                status=ExecutionStatus.COMPILATION_ERROR,
+                stderr=error,
+                error_message=error
+            )
+        source_files = self._source_files(code, filename, config, files)
+        environment = self._submission_env(config, env)
+        
+        # The pool's reset leaves the data directory alone, so runs with data files get their own sandbox
+        async with self._sandbox_for(
+            language, config, resource_limits, memory_limit_bytes, cpu_quota, log=log, allow_pool=not data_files
+        ) as sandbox:
+            if data_files:
+                await asyncio.to_thread(sandbox.write_data_files, data_files)
+            failed, compile_ms = await self._compile_in(
+                sandbox, config, template_args, source_files, environment, compile_args, max_output_bytes, log,
+                start_time, binary=binary
+            )
+            if failed is not None:
+                return failed
+            if config.is_compiled:
+                # The compiler's memory is the container's, but not the program's
+                await asyncio.to_thread(sandbox.reset_memory_peak)
+            return await self._run_in(
+                sandbox, code, filename, config, template_args, source_files, stdin, resource_limits,
+                timeout_seconds, max_output_bytes, environment, on_output, log, start_time, compile_ms,
+                output_encoding=output_encoding
+            )
+    
+    async def _compile_in(
+        self,
+        sandbox: Sandbox,
+        config: LanguageConfig,
+        template_args: Dict[str, str],
+        source_files: Dict[str, str],
+        environment: Dict[str, str],
+        compile_args: Optional[List[str]],
+        max_output_bytes: int,
+        log: SubmissionLogger,
+        start_time: float,
+        binary: Optional[bytes] = None
+    ) -> Tuple[Optional[RunResult], int]:
+        """
+        Write and build the sources of a compiled language; the failed result, if any, and the compile time.
+        
+        An uploaded binary is written where the build would have put its
+        output instead, so run_cmd finds it without building anything.
+        """
+        if binary is not None:
+            await asyncio.to_thread(sandbox.write_executable, template_args["output"], binary)
+            return None, 0
+        if not config.is_compiled:
+            return None, 0
+        build_cmd = self._build_command(config, template_args, compile_args)
+        log.event(COMPILE_STARTED, command=build_cmd)
+        compile_start = time.time()
+        compiled = await self._exec_with_deadline(
+            sandbox,
+            f"sh -c '{self._write_files_command(source_files)} && {build_cmd}'",
+            config.compile_timeout,
+            max_output_bytes=max_output_bytes,
+            environment=self._build_env(config, environment, compile_args),
+            log=log
+        )
+        compile_ms = int((time.time() - compile_start) * 1000)
+        log.event(
+            COMPILE_FINISHED,
+            exit_code=compiled.exit_code,
+            duration_ms=compile_ms,
+            timed_out=compiled.timed_out
+        )
+        if compiled.timed_out:
+            return RunResult(
+                status=ExecutionStatus.COMPILATION_ERROR,
+                stderr="".join(part for part in (compiled.stderr, compiled.stdout) if part),
+                duration_ms=int((time.time() - start_time) * 1000),
+                compile_duration_ms=compile_ms,
+                timed_out=True,
+                error_message="Compilation timed out"
+            ), compile_ms
+        if compiled.exit_code != 0:
+            # Compilers report to either stream; both are diagnostics here
+            diagnostics = "".join(part for part in (compiled.stderr, compiled.stdout) if part)
+            return RunResult(
+                status=ExecutionStatus.COMPILATION_ERROR,
+                stderr=diagnostics,
+                exit_code=compiled.exit_code,
+                duration_ms=int((time.time() - start_time) * 1000),
+                compile_duration_ms=compile_ms,
+                error_message="Compilation failed"
+            ), compile_ms
+        return None, compile_ms
+    
+    async def _run_in(
+        self,
+        sandbox: Sandbox,
+        code: str,
+        filename: str,
+        config: LanguageConfig,
+        template_args: Dict[str, str],
+        source_files: Dict[str, str],
+        stdin: str,
+        resource_limits: ResourceLimits,
+        timeout_seconds: float,
+        max_output_bytes: int,
+        environment: Dict[str, str],
+        on_output: Optional[Callable[[str, bytes], None]],
+        log: SubmissionLogger,
+        start_time: float,
+        compile_ms: int = 0,
+        output_encoding: OutputEncoding = OutputEncoding.UTF8
+    ) -> RunResult:
+        """Run the program once with stdin; compiled languages must already have been built in the sandbox."""
+        run_cmd = config.run_cmd.format(**template_args)
+        log.event(RUN_STARTED, command=run_cmd, timeout_seconds=timeout_seconds)
+        run_start = time.time()
+        ran = await self._exec_with_deadline(
+            sandbox,
+            self._build_execution_command(
+                code, filename, run_cmd, stdin, resource_limits,
+                write_source=not config.is_compiled,
+                timeout_seconds=timeout_seconds,
+                files=source_files
+            ),
+            timeout_seconds,
+            on_output=on_output,
+            max_output_bytes=max_output_bytes,
+            environment=environment,
+            log=log
+        )
+        run_ms = int((time.time() - run_start) * 1000)
+        log.event(
+            RUN_FINISHED,
+            exit_code=ran.exit_code,
+            duration_ms=run_ms,
+            timed_out=ran.timed_out,
+            output_limit_exceeded=ran.output_limit_exceeded
+        )
+        encoded = self._encoded_output(ran, output_encoding)
+        if ran.timed_out:
+            return RunResult(
+                status=ExecutionStatus.TIMEOUT,
+                stdout=ran.stdout,
+                stderr=ran.stderr,
+                **encoded,
+                duration_ms=int((time.time() - start_time) * 1000),
+                compile_duration_ms=compile_ms,
+                run_duration_ms=run_ms,
+                timed_out=True,
+                error_message="Execution timeout"
+            )
+        if ran.output_limit_exceeded:
+            return RunResult(
+                status=ExecutionStatus.OUTPUT_LIMIT_EXCEEDED,
+                stdout=ran.stdout,
+                stderr=ran.stderr,
+                **encoded,
+                duration_ms=int((time.time() - start_time) * 1000),
+                compile_duration_ms=compile_ms,
+                run_duration_ms=run_ms,
+                error_message=f"Output exceeded {max_output_bytes} bytes"
+            )
+        memory = await asyncio.to_thread(sandbox.memory_usage)
+        # Docker's stats would only repeat the earlier peak the cgroup's was measured against
+        if not memory.peak_bytes and not memory.below_baseline:
+            memory.peak_bytes = self._memory_from_stats(await asyncio.to_thread(sandbox.stats))
+        # A running program always uses some memory, so a peak of 0 means it couldn't be measured
+        
+        status = self._classify_exit(
+            ran.exit_code, oom_killed=memory.oom_killed, overran=run_ms >= timeout_seconds * 1000
+        )
+        # Timeouts and OOM kills are signals too, but their status already says why
+        killed_by = exit_signal(ran.exit_code) if status == ExecutionStatus.RUNTIME_ERROR else None
+        return RunResult(
+            status=status,
+            stdout=ran.stdout,
+            stderr=ran.stderr,
+            **encoded,
+            exit_code=ran.exit_code,
+            signal=killed_by.name if killed_by else None,
+            error_message=signal_reason(killed_by) if killed_by else None,
+            duration_ms=int((time.time() - start_time) * 1000),
+            compile_duration_ms=compile_ms,
+            run_duration_ms=run_ms,
+            timed_out=status == ExecutionStatus.TIMEOUT,
+            memory_used_bytes=memory.peak_bytes or None
+        )
+    
+    def _encoded_output(self, ran: ExecOutput, output_encoding: OutputEncoding) -> Dict[str, str]:
+        """The RunResult fields holding the program's exact output, when the submission asked for them."""
+        if output_encoding != OutputEncoding.BASE64:
+            return {}
+        return {
+            "stdout_base64": base64.b64encode(ran.stdout_bytes).decode("ascii"),
+            "stderr_base64": base64.b64encode(ran.stderr_bytes).decode("ascii"),
+        }
+    
+    @asynccontextmanager
+    async def _sandbox_for(
+        self,
+        language: str,
+        config: LanguageConfig,
+        resource_limits: ResourceLimits,
+        memory_limit_bytes: Optional[int] = None,
+        cpu_quota: Optional[float] = None,
+        log: Optional[SubmissionLogger] = None,
+        allow_pool: bool = True
+    ) -> AsyncIterator[Sandbox]:
+        """Check out a pooled sandbox when the limits allow it, otherwise start a fresh one."""
+        log = log or self._submission_logger(language)
+        # The pool only holds each language's default image with default limits
+        pooled_image = allow_pool and self.pool is not None and config.image == get_language_config(language).image
+        default_limits = (
+            memory_limit_bytes in (None, config.default_memory_bytes)
+            and cpu_quota in (None, config.default_cpu_quota or DEFAULT_CPU_QUOTA)
+            and resource_limits == ResourceLimits()
+        )
+        if not pooled_image or not default_limits:
+            try:
+                async with self._started(self._create_sandbox(
+                    config, resource_limits, memory_limit_bytes, job_id=log.submission_id, cpu_quota=cpu_quota
+                )) as sandbox:
+                    with self.metrics.active_containers.track_inprogress():
+                        log.event(SANDBOX_CREATED, container_id=sandbox.container.id, image=config.image, pooled=False)
+                        yield sandbox
+            finally:
+                log.event(SANDBOX_CLEANED_UP, pooled=False)
+            return
+        
+        # A checkout may have to start a container, and a release resets one
+        sandbox = await _off_loop(lambda: self.pool.acquire(getattr(language, "value", language)), self.pool.release)
+        log.event(SANDBOX_CREATED, container_id=sandbox.container.id, image=config.image, pooled=True)
+        try:
+            with self.metrics.active_containers.track_inprogress():
+                yield sandbox
+        except BaseException:
+            # An abandoned exec may still be running; never hand it to the next submission
+            await asyncio.to_thread(sandbox.kill)
+            raise
+        finally:
+            await asyncio.to_thread(self.pool.release, sandbox)
+            log.event(SANDBOX_CLEANED_UP, pooled=True)
+    
+    @asynccontextmanager
+    async def _started(self, sandbox: Sandbox) -> AsyncIterator[Sandbox]:
+        """Start a sandbox and remove it afterwards, both off the event loop since start() may retry for a while."""
+        await _off_loop(sandbox.start, lambda started: started.remove())
+        try:
+            yield sandbox
+        finally:
+            await asyncio.to_thread(sandbox.remove)
+    
+    def _memory_from_stats(self, stats: dict) -> int:
+        """Fallback memory reading from the Docker stats API."""
+        memory_stats = stats.get('memory_stats') or stats.get('memory') or {}
+        return int(memory_stats.get('max_usage') or memory_stats.get('usage') or 0)
+    
+    async def _exec_with_deadline(
+        self,
+        sandbox: Sandbox,
+        command: str,
+        timeout_seconds: float,
+        on_output: Optional[Callable[[str, bytes], None]] = None,
+        max_output_bytes: Optional[int] = None,
+        environment: Optional[Dict[str, str]] = None,
+        log: Optional[SubmissionLogger] = None
+    ) -> ExecOutput:
+        """
+        Exec a command, killing the sandbox from the host if it overruns.
+        
+        The in-container timeout normally fires first; this catches containers
+        that hang before the command even starts, or whose timeout wrapper
+        didn't manage to kill them. Like docker stop, the sandbox's processes
+        get SIGTERM and kill_grace_seconds to exit before the container is
+        killed. Either way the result has timed_out set and whatever output
+        the command produced before it ended.
+        """
+        exec_task = asyncio.ensure_future(
+            asyncio.to_thread(sandbox.exec, command, on_output, max_output_bytes, environment)
+        )
+        try:
+            return await asyncio.wait_for(
+                asyncio.shield(exec_task),
+                timeout=timeout_seconds + self.kill_grace_seconds + EXECUTION_DEADLINE_GRACE_SECONDS
+            )
+        except asyncio.TimeoutError:
+            (log or logger).warning(f"Terminating sandbox after {timeout_seconds}s deadline")
+            await asyncio.to_thread(sandbox.terminate)
+            done, _ = await asyncio.wait({exec_task}, timeout=self.kill_grace_seconds)
+            if exec_task in done and exec_task.exception() is None:
+                # Exited on SIGTERM; its output is complete, including anything printed on the way out
+                output = exec_task.result()
+                output.timed_out = True
+                return output
+            (log or logger).warning(f"Killing sandbox that outlived its {self.kill_grace_seconds:g}s grace period")
+            await asyncio.to_thread(sandbox.kill)
+            return sandbox.partial_output()
+    
+    def _resolve_source(
+        self,
+        code: str,
+        language: str,
+        config: LanguageConfig,
+        files: Optional[Dict[str, str]] = None,
+        entry_point: Optional[str] = None,
+        filename: Optional[str] = None,
+        binary: Optional[bytes] = None
+    ):
+        """Work out the source filename and command template arguments."""
+        if binary is not None:
+            # Nothing is built; the binary stands in for the build output
+            return config.output_filename, {"filename": config.source_filename, "output": config.output_filename}, None
+        requested_filename = filename
+        filename = filename or config.source_filename
+        template_args = {"filename": filename, "output": config.output_filename}
+        if requested_filename:
+            try:
+                validate_submission_path(requested_filename)
+                validate_source_filename(config, requested_filename)
+            except ValueError as e:
+                return filename, template_args, str(e)
+        if files:
+            filename = entry_point or config.source_filename
+            if filename not in files:
+                return filename, template_args, f"Entry point {filename} not found in submitted files"
+            template_args["filename"] = filename
+            if language == Language.JAVA:
+                class_name = self._extract_java_class_name(files[filename])
+                if not class_name:
+                    return filename, template_args, "No public class found in Java code"
+                template_args["classname"] = class_name
+            template_args["stem"] = self._source_stem(filename)
+            return filename, template_args, None
+        if language == Language.JAVA:
+            # Extract class name for Java
+            class_name = self._extract_java_class_name(code)
+            if not class_name:
+                return filename, template_args, "No public class found in Java code"
+            if requested_filename and requested_filename != f"{class_name}.java":
+                # javac insists on the public class living in a file of the same name
+                return filename, template_args, f"Public class {class_name} must be in {class_name}.java, not {requested_filename}"
+            filename = f"{class_name}.java"
+            template_args = {"filename": filename, "output": config.output_filename, "classname": class_name}
+        template_args["stem"] = self._source_stem(filename)
+        return filename, template_args, None
+    
+    def _source_stem(self, filename: str) -> str:
+        """The source's path without its extension, for runners that name build output after it."""
+        return posixpath.splitext(filename)[0]
+    
+    def _source_files(
+        self,
+        code: str,
+        filename: str,
+        config: LanguageConfig,
+        files: Optional[Dict[str, str]] = None
+    ) -> Dict[str, str]:
+        """All files to write into the workdir: the language scaffold plus the submission."""
+        submitted = files or {filename: code}
+        # Schema validation already rejects these; re-checked since paths end up in a shell command
+        for path in submitted:
+            validate_submission_path(path)
+        return {**config.project_files, **submitted}
+    
+    def _submission_env(self, config: LanguageConfig, env: Optional[Dict[str, str]] = None) -> Dict[str, str]:
+        """The language's default environment with the submission's variables merged on top."""
+        # Schema validation already rejects these; re-checked since callers may build requests directly
+        for name, value in (env or {}).items():
+            validate_env_var(name, value)
+        return {**config.env, **(env or {})}
+    
+    def _build_command(
+        self, config: LanguageConfig, template_args: Dict[str, str], compile_args: Optional[List[str]] = None
+    ) -> str:
+        """The language's build command with the submission's compiler flags added."""
+        args = " ".join(compile_args or [])
+        if "{compile_args}" in config.build_cmd:
+            # Collapse the gap an empty {compile_args} leaves
+            return " ".join(config.build_cmd.format(**template_args, compile_args=args).split())
+        return f"{config.build_cmd.format(**template_args)} {args}".rstrip()
+    
+    def _build_env(
+        self, config: LanguageConfig, environment: Dict[str, str], compile_args: Optional[List[str]] = None
+    ) -> Dict[str, str]:
+        """Run environment plus whatever the submission's compiler flags need at build time."""
+        build_env = dict(environment)
+        for arg in compile_args or []:
+            build_env.update(config.compile_arg_env.get(arg, {}))
+        return build_env
+    
+    def _classify_exit(
+        self, exit_code: Optional[int], oom_killed: bool = False, overran: bool = False
+    ) -> ExecutionStatus:
+        if exit_code == 0:
+            return ExecutionStatus.SUCCESS
+        if exit_code == 124:
+            # Exit code of coreutils timeout
+            return ExecutionStatus.TIMEOUT
+        if oom_killed:
+            # A SIGKILL (137) is only a memory failure if the cgroup OOM killer fired
+            return ExecutionStatus.MEMORY_LIMIT_EXCEEDED
+        if exit_code == 137 and overran:
+            # timeout -k escalated to SIGKILL after the grace period
+            return ExecutionStatus.TIMEOUT
+        return ExecutionStatus.RUNTIME_ERROR
+    
+    def _create_sandbox(
+        self,
+        config: LanguageConfig,
+        resource_limits: ResourceLimits,
+        memory_limit_bytes: Optional[int] = None,
+        job_id: Optional[str] = None,
+        cpu_quota: Optional[float] = None
+    ) -> Sandbox:
+        """Create a sandbox with the execution security restrictions applied."""
+        mem_limit = self._memory_limit_for(config, resource_limits, memory_limit_bytes)
+        cpus = self._cpu_quota_for(config, cpu_quota)
+        max_processes = resource_limits.max_processes + config.runtime_threads
+        return Sandbox(
+            self.docker_client,
+            config.image,
+            start_attempts=self.docker_retry_attempts,
+            labels=self._container_labels(job_id),
+            mem_limit=mem_limit,
+            memswap_limit=mem_limit,  # no swap, so overruns hit the OOM killer
+            # Same as docker run --cpus: this many cores' worth of time per period
+            cpu_period=CPU_PERIOD_US,
+            cpu_quota=int(cpus * CPU_PERIOD_US),
+            network_disabled=not self.allow_network,
+            network_mode="bridge" if self.allow_network else "none",
+            read_only=self.read_only_root_fs,
+            security_opt=[f"seccomp={self.seccomp_profile}"] if self.seccomp_profile else None,
+            tmpfs={
+                "/tmp": f"size={resource_limits.memory_mb}m,noexec",
+                # Docker mounts tmpfs noexec by default; compiled binaries are run from here
+                "/app/code": f"size={resource_limits.memory_mb}m,exec,uid=1000,gid=1000",
+                # Owned by root; data files are written there read-only before the submission starts
+                "/app/data": f"size={resource_limits.memory_mb}m,noexec,mode=755",
+                # Holds the workdir snapshot between test cases, out of the submission's reach
+                SNAPSHOT_DIR: f"size={resource_limits.memory_mb}m,noexec,mode=700",
+            },
+            user="coderunner",
+            # The idle init process, exec shell and timeout wrapper need room too
+            pids_limit=min(max_processes + SANDBOX_PROCESS_OVERHEAD, self.pids_limit),
+            ulimits=[
+                docker.types.Ulimit(name='nproc', soft=max_processes, hard=max_processes),
+                docker.types.Ulimit(name='nofile', soft=resource_limits.max_files, hard=resource_limits.max_files),
+            ]
+        )
+    
+    def _memory_limit_for(
+        self, config: LanguageConfig, resource_limits: ResourceLimits, memory_limit_bytes: Optional[int] = None
+    ) -> int:
+        # Language defaults are capped like requested limits, in case the caps were lowered below them
+        return memory_limit_bytes or min(
+            self._default_memory_bytes(config, resource_limits), self.max_limits["memory_limit_bytes"]
+        )
+    
+    def _cpu_quota_for(self, config: LanguageConfig, cpu_quota: Optional[float] = None) -> float:
+        return cpu_quota or min(config.default_cpu_quota or DEFAULT_CPU_QUOTA, self.max_limits["cpu_quota"])
+    
+    def _default_memory_bytes(self, config: LanguageConfig, resource_limits: ResourceLimits) -> int:
+        """The language's default memory limit, unless the submission changed resource_limits.memory_mb."""
+        if config.default_memory_bytes and resource_limits.memory_mb == ResourceLimits().memory_mb:
+            return config.default_memory_bytes
+        return resource_limits.memory_mb * 1024 * 1024
+    
+    def _container_labels(self, job_id: Optional[str] = None) -> Dict[str, str]:
+        return {
+            EXECUTION_LABEL: "true",
+            JOB_ID_LABEL: job_id or current_job_id.get() or str(uuid.uuid4()),
+        }
+    
+    async def _compile_code(self, code: str, language: str, config: LanguageConfig) -> CompilationResult:
+        """Compile code if compilation is required."""
+        try:
+            filename, template_args, error = self._resolve_source(code, language, config)
+            if error:
+                return CompilationResult(
+                    success=False,
+                    output="",
+                    error_message=error
+                )
+            
+            build_cmd = self._build_command(config, template_args)
+            source_files = self._source_files(code, filename, config)
+            async with self._started(self._create_sandbox(config, ResourceLimits(memory_mb=256))) as sandbox:
+                compiled = await self._exec_with_deadline(
+                    sandbox,
+                    f"sh -c '{self._write_files_command(source_files)} && {build_cmd}'",
+                    config.compile_timeout,
+                    max_output_bytes=DEFAULT_MAX_OUTPUT_BYTES
+                )
+            
+            output = "".join(part for part in (compiled.stdout, compiled.stderr) if part)
+            if compiled.timed_out:
+                return CompilationResult(
+                    success=False,
+                    output=output,
+                    error_message="Compilation timeout"
+                )
+            
+            if compiled.exit_code == 0:
+                return CompilationResult(
+                    success=True,
+                    output=output
+                )
+            return CompilationResult(
+                success=False,
+                output=output,
+                error_message="Compilation failed"
+            )
                         
         except Exception as e:
             logger.error(f"Compilation error: {str(e)}")
@@ -311,154 +1359,85 @@ class CodeExecutionService:
     async def _execute_test_case(
         self, 
         code: str, 
-        language: Language, 
+        language: str, 
         test_case: TestCase, 
-        config: Dict,
-        resource_limits: ResourceLimits
+        config: LanguageConfig,
+        resource_limits: ResourceLimits,
+        strict: bool = False,
+        timeout_seconds: Optional[float] = None,
+        memory_limit_bytes: Optional[int] = None,
+        cpu_quota: Optional[float] = None,
+        max_output_bytes: int = DEFAULT_MAX_OUTPUT_BYTES,
+        files: Optional[Dict[str, str]] = None,
+        entry_point: Optional[str] = None,
+        filename: Optional[str] = None,
+        env: Optional[Dict[str, str]] = None,
+        compile_args: Optional[List[str]] = None,
+        data_files: Optional[Dict[str, bytes]] = None,
+        log: Optional[SubmissionLogger] = None
     ) -> TestCaseResult:
         """Execute a single test case."""
-        start_time = time.time()
-        
-        try:
-            # Prepare execution environment
-            execution_id = str(uuid.uuid4())
-            filename = f"code{config['file_extension']}"
-            
-            # Build run command
-            run_cmd = config["run_command"]
-            if language == Language.JAVA:
-                class_name = self._extract_java_class_name(code)
-                if not class_name:
-                    return TestCaseResult(
-                        input=test_case.input,
-                        expected_output=test_case.expected_output,
-                        actual_output="",
-                        status=ExecutionStatus.COMPILATION_ERROR,
-                        execution_time_ms=0,
-                        memory_used_mb=0,
-                        passed=False,
-                        error_message="No public class found"
-                    )
-                filename = f"{class_name}.java"
-                run_cmd = run_cmd.format(classname=class_name)
-            elif language in [Language.CPP, Language.CSHARP, Language.GO, Language.RUST]:
-                run_cmd = run_cmd.format(output="program")
-            else:
-                run_cmd = run_cmd.format(filename=filename)
-            
-            # Create secure execution command
-            full_command = self._build_execution_command(
-                code, filename, run_cmd, test_case.input, resource_limits
-            )
-            
-            # Run in container with security restrictions
-            container = self.docker_client.containers.run(
-                config["image"],
-                command=full_command,
-                detach=True,
-                mem_limit=f"{resource_limits.memory_mb}m",
-                cpu_period=100000,
-                cpu_quota=int(resource_limits.cpu_time_seconds * 10000),  # CPU quota
-                network_disabled=True,
-                read_only=True,
-                tmpfs={"/tmp": f"size={resource_limits.memory_mb}m,noexec"},
-                user="coderunner",
-                pids_limit=resource_limits.max_processes,
-                ulimits=[
-                    docker.types.Ulimit(name='nproc', soft=resource_limits.max_processes, hard=resource_limits.max_processes),
-                    docker.types.Ulimit(name='nofile', soft=resource_limits.max_files, hard=resource_limits.max_files),
-                ]
-            )
+        run = await self._run_submission(
+            code, language, config, test_case.input, resource_limits,
+            timeout_seconds=timeout_seconds,
+            memory_limit_bytes=memory_limit_bytes,
+            cpu_quota=cpu_quota,
+            max_output_bytes=max_output_bytes,
+            files=files,
+            entry_point=entry_point,
+            filename=filename,
+            env=env,
+            compile_args=compile_args,
+            data_files=data_files,
+            log=log
+        )
+        self.metrics.record_run(language, run)
+        return self._grade_test_case(test_case, run, strict)
+    
+    def _grade_test_case(self, test_case: TestCase, run: RunResult, strict: bool = False) -> TestCaseResult:
+        """Compare one run's output with the test case's expected output."""
+        if run.status == ExecutionStatus.SUCCESS:
+            # TODO: Sanitize output for security
+            actual_output = run.stdout.strip()
+            mode = test_case.compare_mode or (CompareMode.EXACT if strict else CompareMode.TRIM_TRAILING_WHITESPACE)
+            diff = compare_output(test_case.expected_output, run.stdout, mode, test_case.float_epsilon)
+            passed = diff is None
             
-            # Wait for execution with timeout
-            try:
-                result = container.wait(timeout=resource_limits.wall_time_seconds)
-                logs = container.logs().decode('utf-8')
-                stats = container.stats(stream=False)
-                
-                # Parse memory usage
-                memory_used_mb = 0
-                if 'memory' in stats and 'usage' in stats['memory']:
-                    memory_used_mb = stats['memory']['usage'] / (1024 * 1024)
-                
-                execution_time_ms = int((time.time() - start_time) * 1000)
-                
-                # Check execution result
-                if result['StatusCode'] == 0:
-                    # TODO: Sanitize output for security
-                    actual_output = logs.strip()
-                    expected_output = test_case.expected_output.strip()
-                    passed = actual_output == expected_output
-                    
-                    return TestCaseResult(
-                        input=test_case.input,
-                        expected_output=test_case.expected_output,
-                        actual_output=actual_output,
-                        status=ExecutionStatus.SUCCESS if passed else ExecutionStatus.RUNTIME_ERROR,
-                        execution_time_ms=execution_time_ms,
-                        memory_used_mb=memory_used_mb,
-                        passed=passed,
-                        error_message=None if passed else "Output mismatch"
-                    )
-                else:
-                    # Check for specific error types
-                    if "killed" in logs.lower() or result['StatusCode'] == 137:
-                        status = ExecutionStatus.MEMORY_LIMIT_EXCEEDED
-                        error_msg = "Memory limit exceeded"
-                    elif result['StatusCode'] == 124:
-                        status = ExecutionStatus.TIMEOUT
-                        error_msg = "Execution timeout"
-                    else:
-                        status = ExecutionStatus.RUNTIME_ERROR
-                        error_msg = f"Runtime error (exit code: {result['StatusCode']})"
-                    
-                    return TestCaseResult(
-                        input=test_case.input,
-                        expected_output=test_case.expected_output,
-                        actual_output=logs,
-                        status=status,
-                        execution_time_ms=execution_time_ms,
-                        memory_used_mb=memory_used_mb,
-                        passed=False,
-                        error_message=error_msg
-                    )
-                    
-            except Exception as e:
-                if "timeout" in str(e).lower():
-                    status = ExecutionStatus.TIMEOUT
-                    error_msg = "Execution timeout"
-                else:
-                    status = ExecutionStatus.INTERNAL_ERROR
-                    error_msg = f"Execution error: {str(e)}"
-                
-                return TestCaseResult(
-                    input=test_case.input,
-                    expected_output=test_case.expected_output,
-                    actual_output="",
-                    status=status,
-                    execution_time_ms=int((time.time() - start_time) * 1000),
-                    memory_used_mb=0,
-                    passed=False,
-                    error_message=error_msg
-                )
-            finally:
-                try:
-                    container.remove(force=True)
-                except:
-                    pass
-                    
-        except Exception as e:
-            logger.error(f"Test case execution error: {str(e)}")
             return TestCaseResult(
                 input=test_case.input,
                 expected_output=test_case.expected_output,
-                actual_output="",
-                status=ExecutionStatus.INTERNAL_ERROR,
-                execution_time_ms=int((time.time() - start_time) * 1000),
-                memory_used_mb=0,
-                passed=False,
-                error_message=f"Internal error: {str(e)}"
+                actual_output=actual_output,
+                status=ExecutionStatus.SUCCESS if passed else ExecutionStatus.RUNTIME_ERROR,
+                execution_time_ms=run.duration_ms,
+                memory_used_mb=run.memory_used_mb,
+                passed=passed,
+                error_message=None if passed else "Output mismatch",
+                diff=diff,
+                run=run
             )
+        
+        if run.status == ExecutionStatus.MEMORY_LIMIT_EXCEEDED:
+            error_msg = "Memory limit exceeded"
+        elif run.status == ExecutionStatus.TIMEOUT:
+            error_msg = "Execution timeout"
+        elif run.status in (ExecutionStatus.COMPILATION_ERROR, ExecutionStatus.OUTPUT_LIMIT_EXCEEDED):
+            error_msg = run.error_message
+        elif run.signal:
+            error_msg = f"Runtime error: {run.error_message}"
+        else:
+            error_msg = f"Runtime error (exit code: {run.exit_code})"
+        
+        return TestCaseResult(
+            input=test_case.input,
+            expected_output=test_case.expected_output,
+            actual_output=run.stdout,
+            status=run.status,
+            execution_time_ms=run.duration_ms,
+            memory_used_mb=run.memory_used_mb,
+            passed=False,
+            error_message=error_msg,
+            run=run
+        )
     
     def _build_execution_command(
         self, 
@@ -466,42 +1445,60 @@ class CodeExecutionService:
         filename: str, 
         run_cmd: str, 
         input_data: str,
-        resource_limits: ResourceLimits
+        resource_limits: ResourceLimits,
+        write_source: bool = True,
+        timeout_seconds: Optional[float] = None,
+        files: Optional[Dict[str, str]] = None
     ) -> str:
         """Build secure execution command with input handling."""
-        # Escape code and input for shell safety
-        escaped_code = code.replace('"', '\\"').replace('`', '\\`').replace('\n', '\\n')
-        escaped_input = input_data.replace('"', '\\"').replace('`', '\\`').replace('\n', '\\n')
-        
-        # Build command with timeout and resource limits
+        # Code and input are written through base64 so quotes, backticks and
+        # newlines in either can't break out of the shell command. Compiled
+        # languages already wrote the source during the build step. Input is
+        # redirected from a file so the program sees EOF right after it.
+        if timeout_seconds is None:
+            timeout_seconds = resource_limits.wall_time_seconds
+        write_code = f"{self._write_files_command(files or {filename: code})} &&" if write_source else ""
         command = f'''sh -c '
-            echo "{escaped_code}" > {filename} && 
-            timeout {resource_limits.wall_time_seconds}s sh -c "
-                echo \\"{escaped_input}\\" | {run_cmd}
-            "
+            {write_code}
+            {self._write_file_command(".stdin", input_data)} &&
+            timeout -k {self.kill_grace_seconds:g}s {timeout_seconds:g}s {run_cmd} < .stdin
         ' '''
         
         return command
     
+    def _write_files_command(self, files: Dict[str, str]) -> str:
+        """Write several files relative to the workdir, creating subdirectories first."""
+        commands = []
+        directories = sorted({posixpath.dirname(path) for path in files} - {""})
+        if directories:
+            commands.append(f"mkdir -p {' '.join(directories)}")
+        commands.extend(self._write_file_command(path, content) for path, content in files.items())
+        return " && ".join(commands)
+    
+    def _write_file_command(self, path: str, content: str) -> str:
+        """Build a shell-safe command that writes content to a file in the container."""
+        encoded = base64.b64encode(content.encode("utf-8")).decode("ascii")
+        return f"echo {encoded} | base64 -d > {path}"
+    
     def _extract_java_class_name(self, code: str) -> Optional[str]:
         """Extract public class name from Java code."""
         import re
-        match = re.search(r'public\s+class\s+(\w+)', code)
+        match = re.search(r'public\s+(?:(?:final|abstract|strictfp)\s+)*class\s+(\w+)', code)
         return match.group(1) if match else None
     
     async def validate_syntax(self, request: ValidationRequest) -> ValidationResult:
         """Validate code syntax without execution."""
         try:
-            if request.language not in self.language_configs:
+            try:
+                config = get_language_config(request.language)
+            except UnsupportedLanguageError as e:
                 return ValidationResult(
                     is_valid=False,
-                    syntax_errors=[f"Unsupported language: {request.language}"]
+                    syntax_errors=[str(e)]
                 )
             
-            config = self.language_configs[request.language]
-            
             # For compiled languages, try compilation
-            if config["compile_command"]:
+            if config.is_compiled:
                 compilation_result = await self._compile_code(request.code, request.language, config)
                 if compilation_result.success:
                     return ValidationResult(
@@ -550,15 +1547,17 @@ class CodeExecutionService:
         """Validate JavaScript syntax using Node.js."""
         try:
             # Use Node.js to check syntax
-            config = self.language_configs[Language.JAVASCRIPT]
+            config = get_language_config(Language.JAVASCRIPT)
             container = self.docker_client.containers.run(
-                config["image"],
+                config.image,
                 command=f'sh -c \'echo "{code.replace(chr(34), chr(92)+chr(34))}" | node --check\'',
                 detach=True,
                 mem_limit="64m",
                 network_disabled=True,
+                network_mode="none",
                 read_only=True,
-                user="coderunner"
+                user="coderunner",
+                labels=self._container_labels()
             )
             
             result = container.wait(timeout=10)
@@ -582,53 +1581,120 @@ class CodeExecutionService:
     def get_supported_languages(self) -> List[LanguageInfo]:
         """Get information about supported languages."""
         languages = []
-        for lang, config in self.language_configs.items():
+        for name, config in self.language_configs.items():
             languages.append(LanguageInfo(
-                name=lang.value,
-                version="latest",  # Could be made dynamic
-                file_extension=config["file_extension"],
-                compile_command=config["compile_command"],
-                run_command=config["run_command"],
-                supported_features=["syntax_highlighting", "auto_completion", "error_detection"]
+                name=name,
+                version=config.version or "latest",
+                file_extension=config.file_extension,
+                compile_command=config.build_cmd,
+                run_command=config.run_cmd,
+                supported_features=["syntax_highlighting", "auto_completion", "error_detection"],
+                limits=self._language_limits(config)
             ))
         return languages
     
+    def update_language_limits(self, language: str, limits: LanguageLimits) -> LanguageLimits:
+        """
+        Change a language's default limits for submissions validated from now on.
+        
+        Runs already in progress keep their limits. Idle pooled sandboxes
+        were started with the old ones, so the language's pool is drained.
+        Raises UnsupportedLanguageError for unregistered languages and
+        LimitTooHighError for limits above max_limits.
+        """
+        for field, limit in self.max_limits.items():
+            value = getattr(limits, field, None)
+            if value is not None and value > limit:
+                raise LimitTooHighError(field, value, limit)
+        config = set_language_limits(
+            language,
+            default_memory_bytes=limits.memory_limit_bytes,
+            default_cpu_quota=limits.cpu_quota,
+            default_timeout=limits.timeout_ms / 1000
+        )
+        if self.pool is not None:
+            self.pool.drain(getattr(language, "value", language))
+        self.logger.info(f"Updated default limits for {getattr(language, 'value', language)}: {limits}")
+        return self._language_limits(config)
+    
+    def _language_limits(self, config: LanguageConfig) -> LanguageLimits:
+        return LanguageLimits(
+            memory_limit_bytes=config.default_memory_bytes,
+            cpu_quota=config.default_cpu_quota,
+            timeout_ms=int(config.default_timeout * 1000)
+        )
+    
     async def build_docker_images(self):
         """Build all Docker images for code execution."""
-        for language, config in self.language_configs.items():
+        for image, config in self._images().items():
+            if not config.dockerfile:
+                continue
             try:
-                logger.info(f"Building Docker image for {language.value}...")
+                logger.info(f"Building Docker image {image}...")
                 self.docker_client.images.build(
                     path=".",
-                    dockerfile=config["dockerfile"],
-                    tag=config["image"],
+                    dockerfile=config.dockerfile,
+                    tag=image,
+                    buildargs=config.build_args or None,
                     rm=True
                 )
-                logger.info(f"Successfully built {config['image']}")
+                logger.info(f"Successfully built {image}")
             except Exception as e:
-                logger.error(f"Failed to build {config['image']}: {str(e)}")
+                logger.error(f"Failed to build {image}: {str(e)}")
                 raise
     
     def cleanup_containers(self):
         """Clean up any orphaned containers."""
+        self.cleanup_orphans()
+    
+    def cleanup_orphans(self) -> int:
+        """
+        Force-remove every container carrying the execution label.
+        
+        Runs once at startup to clear containers left behind by a crashed
+        server; returns how many were removed.
+        """
+        removed = 0
         try:
             containers = self.docker_client.containers.list(
                 all=True,
-                filters={"ancestor": list(config["image"] for config in self.language_configs.values())}
+                filters={"label": f"{EXECUTION_LABEL}=true"}
             )
             for container in containers:
                 try:
                     container.remove(force=True)
-                    logger.info(f"Removed orphaned container: {container.id}")
+                    removed += 1
+                    job_id = container.labels.get(JOB_ID_LABEL)
+                    logger.info(f"Removed orphaned container: {container.id} (job {job_id})")
                 except Exception as e:
                     logger.warning(f"Failed to remove container {container.id}: {str(e)}")
         except Exception as e:
             logger.error(f"Container cleanup error: {str(e)}")
+        return removed
 
 
 print("DEBUG: CodeExecutionService class defined successfully")
 
 # Global instance
 print("DEBUG: About to create global instance")
-execution_service = CodeExecutionService()
+execution_service = CodeExecutionService(
+    pool_size=settings.execution_pool_size,
+    allow_network=settings.execution_allow_network,
+    read_only_root_fs=settings.execution_read_only_root_fs,
+    pids_limit=settings.execution_pids_limit,
+    seccomp_profile=settings.execution_seccomp_profile or DEFAULT_SECCOMP_PROFILE,
+    kill_grace_seconds=settings.execution_kill_grace_seconds,
+    result_cache=ResultCache(
+        settings.execution_result_cache_size, settings.execution_result_cache_ttl_seconds
+    ) if settings.execution_result_cache_size > 0 else None,
+    pull_images=settings.execution_pull_images,
+    docker_retry_attempts=settings.execution_docker_retry_attempts,
+    max_limits={
+        "timeout_ms": settings.execution_max_timeout_ms,
+        "memory_limit_bytes": settings.execution_max_memory_bytes,
+        "cpu_quota": settings.execution_max_cpu_quota,
+        "max_output_bytes": settings.execution_max_output_bytes,
+    },
+    allow_binary_upload=settings.execution_allow_binary_upload
+)
 print("DEBUG: Global instance created successfully")
\ No newline at end of file
@@ -0,0 +1,154 @@
+"""
+Measures the executor's own overhead per language, to set fair time limits.
+
+A trivial program is run repeatedly, first in a container started for each
+run and then in a warm pooled one, so the report shows both what a
+submission pays on top of its own run time and what pooling saves. Pulling
+a missing image is timed once and kept apart from container start, which is
+timed on its own with nothing run in the container.
+"""
+
+import asyncio
+import copy
+import math
+import statistics
+import time
+from typing import Callable, List, Optional, Tuple
+
+from docker.errors import ImageNotFound
+
+from app.core.execution_languages import InvalidSubmissionError, LanguageConfig, get_language_config
+from app.schemas.execution import (
+    BenchmarkReport, DurationStats, ExecutionStatus, Language, ResourceLimits, RunRequest, RunResult
+)
+from app.services.execution import CodeExecutionService, ExecutionUnavailableError, execution_service
+from app.services.execution_pool import ContainerPool
+
+MAX_BENCHMARK_ITERATIONS = 50
+
+# Each prints one line and exits, so the timings are almost all executor overhead
+BENCHMARK_PROGRAMS = {
+    Language.PYTHON.value: "print('ok')\n",
+    Language.JAVASCRIPT.value: "console.log('ok');\n",
+    Language.JAVA.value: (
+        "public class Main {\n"
+        "    public static void main(String[] args) {\n"
+        "        System.out.println(\"ok\");\n"
+        "    }\n"
+        "}\n"
+    ),
+    Language.CPP.value: "#include <cstdio>\nint main() { std::puts(\"ok\"); }\n",
+    Language.CSHARP.value: "System.Console.WriteLine(\"ok\");\n",
+    Language.GO.value: "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"ok\") }\n",
+    Language.RUST.value: "fn main() { println!(\"ok\"); }\n",
+    Language.PHP.value: "<?php echo \"ok\\n\";\n",
+    Language.TYPESCRIPT.value: "const message: string = 'ok';\nconsole.log(message);\n",
+}
+
+
+class NoBenchmarkProgramError(InvalidSubmissionError):
+    """Raised for registered languages that have no benchmark program."""
+
+
+async def benchmark(
+    language: str,
+    iterations: int = 10,
+    service: Optional[CodeExecutionService] = None
+) -> BenchmarkReport:
+    """
+    Time the executor's overhead for one language over the given number of runs.
+
+    Raises UnsupportedLanguageError for unknown languages, ValueError for an
+    iteration count out of range, and ExecutionUnavailableError when Docker,
+    the image or the benchmark program itself fails.
+    """
+    service = service or execution_service
+    language = getattr(language, "value", language)
+    config = get_language_config(language)
+    if language not in BENCHMARK_PROGRAMS:
+        raise NoBenchmarkProgramError(f"No benchmark program for language: {language}")
+    if not 1 <= iterations <= MAX_BENCHMARK_ITERATIONS:
+        raise ValueError(f"Iterations must be between 1 and {MAX_BENCHMARK_ITERATIONS}, got {iterations}")
+    if not service.docker_client:
+        raise ExecutionUnavailableError("Docker is not available")
+
+    image_pull_ms = await asyncio.to_thread(_pull_if_missing, service, config)
+    start_ms = [await asyncio.to_thread(_time_container_start, service, config) for _ in range(iterations)]
+
+    request = RunRequest(code=BENCHMARK_PROGRAMS[language], language=language)
+    cold = copy.copy(service)
+    cold.pool = None
+    cold_runs = [await _timed_run(cold, request) for _ in range(iterations)]
+
+    pooled = copy.copy(service)
+    pooled.pool = ContainerPool(
+        1, lambda name: service._create_sandbox(get_language_config(name), ResourceLimits(), job_id="benchmark")
+    )
+    try:
+        # Started before timing begins, as the service's own pool is at startup
+        await asyncio.to_thread(pooled.pool.warm, [language])
+        pooled_runs = [await _timed_run(pooled, request) for _ in range(iterations)]
+    finally:
+        await asyncio.to_thread(pooled.pool.close)
+
+    cold_total = duration_stats([total for total, _ in cold_runs])
+    pooled_total = duration_stats([total for total, _ in pooled_runs])
+    results = [result for _, result in cold_runs + pooled_runs]
+    return BenchmarkReport(
+        language=language,
+        iterations=iterations,
+        image_pull_ms=image_pull_ms,
+        container_start=duration_stats(start_ms),
+        compile=duration_stats([r.compile_duration_ms for r in results]) if config.is_compiled else None,
+        run=duration_stats([r.run_duration_ms for r in results]),
+        cold_total=cold_total,
+        pooled_total=pooled_total,
+        pooled_saving_ms=cold_total.median_ms - pooled_total.median_ms
+    )
+
+
+def duration_stats(durations_ms: List[int]) -> DurationStats:
+    """Min, median and nearest-rank 95th percentile of the durations."""
+    ordered = sorted(durations_ms)
+    return DurationStats(
+        min_ms=ordered[0],
+        median_ms=int(statistics.median(ordered)),
+        p95_ms=ordered[math.ceil(0.95 * len(ordered)) - 1]
+    )
+
+
+def _pull_if_missing(service: CodeExecutionService, config: LanguageConfig) -> int:
+    try:
+        service.docker_client.images.get(config.image)
+        return 0
+    except ImageNotFound:
+        pass
+    if not service.pull_images:
+        raise ExecutionUnavailableError(f"Docker image {config.image} not found and image pulling is disabled")
+    return _elapsed_ms(lambda: service._pull_image(config.image))
+
+
+def _time_container_start(service: CodeExecutionService, config: LanguageConfig) -> int:
+    sandbox = service._create_sandbox(config, ResourceLimits(), job_id="benchmark")
+    try:
+        return _elapsed_ms(sandbox.start)
+    finally:
+        sandbox.remove()
+
+
+async def _timed_run(service: CodeExecutionService, request: RunRequest) -> Tuple[int, RunResult]:
+    started = time.monotonic()
+    # Straight to the executor: benchmark runs aren't cached or counted in the submission metrics
+    result = await service._run_request(request)
+    total_ms = int((time.monotonic() - started) * 1000)
+    if result.status != ExecutionStatus.SUCCESS:
+        raise ExecutionUnavailableError(
+            f"Benchmark program failed with {result.status.value}: {result.error_message or result.stderr}"
+        )
+    return total_ms, result
+
+
+def _elapsed_ms(action: Callable[[], object]) -> int:
+    started = time.monotonic()
+    action()
+    return int((time.monotonic() - started) * 1000)
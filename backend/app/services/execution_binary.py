@@ -0,0 +1,47 @@
+"""
+Checks for precompiled binaries submitted in place of source.
+
+Only the ELF header is read: enough to tell an executable from anything
+else and which CPU it targets. Whether a binary is safe to run is left to
+the sandbox, which applies the same limits as to one built from source.
+"""
+
+import platform
+from typing import Optional
+
+from app.schemas.execution import Architecture
+
+ELF_MAGIC = b"\x7fELF"
+ELF_HEADER_BYTES = 20  # up to and including e_machine
+
+# e_type values for programs: fixed-address and position-independent executables
+ELF_EXECUTABLE_TYPES = (2, 3)
+
+# e_machine values from the ELF spec
+ELF_MACHINES = {
+    0x3E: Architecture.X86_64,
+    0xB7: Architecture.AARCH64,
+}
+
+# platform.machine() names architectures differently per OS
+_MACHINE_NAMES = {
+    "x86_64": Architecture.X86_64,
+    "amd64": Architecture.X86_64,
+    "aarch64": Architecture.AARCH64,
+    "arm64": Architecture.AARCH64,
+}
+
+
+def elf_architecture(data: bytes) -> Optional[Architecture]:
+    """The architecture an ELF executable was built for; None if data isn't one for a supported CPU."""
+    if len(data) < ELF_HEADER_BYTES or not data.startswith(ELF_MAGIC):
+        return None
+    byteorder = "little" if data[5] == 1 else "big"
+    if int.from_bytes(data[16:18], byteorder) not in ELF_EXECUTABLE_TYPES:
+        return None
+    return ELF_MACHINES.get(int.from_bytes(data[18:20], byteorder))
+
+
+def host_architecture() -> Optional[Architecture]:
+    """This host's architecture, which sandboxes share since they run on the local daemon."""
+    return _MACHINE_NAMES.get(platform.machine().lower())
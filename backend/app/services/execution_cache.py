@@ -0,0 +1,65 @@
+import hashlib
+import json
+import time
+from collections import OrderedDict
+from typing import Callable, Optional, Tuple
+
+from app.schemas.execution import ExecutionStatus, RunRequest, RunResult
+
+# Request fields that don't change what a run produces
+_UNCACHED_FIELDS = {"cacheable"}
+
+
+def cache_key(request: RunRequest, resolved: Optional[dict] = None) -> str:
+    """
+    Hash of everything that determines a run's outcome: language, source, stdin and limits.
+
+    resolved holds what the request doesn't pin down itself, such as the
+    limits it gets from the language defaults and the image ID.
+    """
+    fields = request.model_dump(mode="json", exclude=_UNCACHED_FIELDS)
+    if resolved is not None:
+        fields["resolved"] = resolved
+    return hashlib.sha256(json.dumps(fields, sort_keys=True).encode()).hexdigest()
+
+
+class ResultCache:
+    """
+    In-memory LRU cache of run results, so identical re-runs skip Docker.
+
+    Entries expire ttl_seconds after they were stored; once max_size
+    entries are held, the least recently used one is evicted. Only results
+    of runs that actually executed are stored, never internal errors.
+    Lookups pass the same resolved settings as cache_key, so a change to
+    the language defaults or a rebuilt image misses the cache.
+    """
+
+    def __init__(self, max_size: int = 256, ttl_seconds: float = 300, clock: Callable[[], float] = time.monotonic):
+        self.max_size = max_size
+        self.ttl_seconds = ttl_seconds
+        self.clock = clock
+        self._entries: "OrderedDict[str, Tuple[float, RunResult]]" = OrderedDict()
+
+    def get(self, request: RunRequest, resolved: Optional[dict] = None) -> Optional[RunResult]:
+        key = cache_key(request, resolved)
+        entry = self._entries.get(key)
+        if entry is None:
+            return None
+        stored_at, result = entry
+        if self.clock() - stored_at >= self.ttl_seconds:
+            del self._entries[key]
+            return None
+        self._entries.move_to_end(key)
+        return result.model_copy(update={"cached": True})
+
+    def put(self, request: RunRequest, result: RunResult, resolved: Optional[dict] = None):
+        if result.status == ExecutionStatus.INTERNAL_ERROR:
+            return
+        key = cache_key(request, resolved)
+        self._entries[key] = (self.clock(), result.model_copy())
+        self._entries.move_to_end(key)
+        while len(self._entries) > self.max_size:
+            self._entries.popitem(last=False)
+
+    def __len__(self) -> int:
+        return len(self._entries)
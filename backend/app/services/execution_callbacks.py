@@ -0,0 +1,151 @@
+import asyncio
+import hashlib
+import hmac
+import ipaddress
+import logging
+import socket
+from typing import Iterable, Optional
+from urllib.parse import SplitResult, urlsplit, urlunsplit
+
+import httpx
+
+from app.schemas.execution import JobCallback, RunResult
+from app.services.execution_verdict import run_verdict
+
+logger = logging.getLogger(__name__)
+
+SIGNATURE_HEADER = "X-CodeHub-Signature"
+SUBMISSION_ID_HEADER = "X-CodeHub-Submission-Id"
+
+# Responses worth retrying besides 5xx; any other 4xx means the receiver rejected the callback
+RETRYABLE_STATUS_CODES = {408, 429}
+
+
+class CallbackUrlError(ValueError):
+    """Raised for callback URLs the server mustn't POST to, e.g. ones resolving to private addresses."""
+
+
+def is_public_address(address: str) -> bool:
+    """Whether an IP address is reachable on the internet, rather than loopback, private, link-local or reserved."""
+    try:
+        ip = ipaddress.ip_address(address.split("%", 1)[0])
+    except ValueError:
+        return False
+    # ::ffff:127.0.0.1 reaches the same host as 127.0.0.1
+    if ip.version == 6 and ip.ipv4_mapped:
+        ip = ip.ipv4_mapped
+    return ip.is_global and not ip.is_multicast
+
+
+def sign_payload(secret: str, body: bytes) -> str:
+    """Signature header value for a callback body: HMAC-SHA256 of the raw bytes, hex encoded."""
+    return "sha256=" + hmac.new(secret.encode(), body, hashlib.sha256).hexdigest()
+
+
+def verify_signature(secret: str, body: bytes, signature: str) -> bool:
+    """Check a received signature header against the body, in constant time."""
+    return hmac.compare_digest(sign_payload(secret, body), signature or "")
+
+
+class CallbackSender:
+    """
+    POSTs finished jobs' results to their callback URLs.
+
+    The body is a JobCallback, signed with the shared secret in the
+    X-CodeHub-Signature header so receivers can check it came from here;
+    the job ID is also sent as X-CodeHub-Submission-Id. Connection errors,
+    timeouts, 5xx, 408 and 429 are retried with exponential backoff (0.5s,
+    1s, ...) up to attempts tries. Redirects aren't followed. Unless their
+    host is in allowed_hosts, callbacks only go to public addresses, so
+    submitters can't make the server POST into its own network.
+    """
+
+    def __init__(
+        self,
+        secret: str,
+        attempts: int = 3,
+        backoff_seconds: float = 0.5,
+        timeout_seconds: float = 5.0,
+        allowed_hosts: Iterable[str] = ()
+    ):
+        if not secret:
+            raise ValueError("A secret is required to sign callbacks")
+        self.secret = secret
+        self.attempts = attempts
+        self.backoff_seconds = backoff_seconds
+        self.timeout_seconds = timeout_seconds
+        self.allowed_hosts = {host.lower() for host in allowed_hosts}
+
+    async def check_url(self, url: str) -> Optional[str]:
+        """
+        The address a callback to url connects to, or None for an allowed host; raises CallbackUrlError.
+
+        Hosts outside allowed_hosts must resolve only to public addresses,
+        which rules out loopback, private networks and cloud metadata
+        endpoints such as 169.254.169.254.
+        """
+        parsed = urlsplit(url)
+        if parsed.scheme not in ("http", "https") or not parsed.hostname:
+            raise CallbackUrlError(f"Callback URL must be http or https with a host: {url}")
+        if parsed.hostname in self.allowed_hosts:
+            return None
+        port = parsed.port or (443 if parsed.scheme == "https" else 80)
+        try:
+            infos = await asyncio.get_running_loop().getaddrinfo(parsed.hostname, port, type=socket.SOCK_STREAM)
+        except socket.gaierror as e:
+            raise CallbackUrlError(f"Callback host {parsed.hostname} can't be resolved: {e}")
+        addresses = [info[4][0] for info in infos]
+        # Every address must be public, since the connection could go to any of them
+        for address in addresses:
+            if not is_public_address(address):
+                raise CallbackUrlError(f"Callback host {parsed.hostname} resolves to non-public address {address}")
+        if not addresses:
+            raise CallbackUrlError(f"Callback host {parsed.hostname} can't be resolved")
+        return addresses[0]
+
+    async def send(self, url: str, job_id: str, result: RunResult) -> bool:
+        """Deliver a job's result, returning whether the receiver accepted it."""
+        body = JobCallback(job_id=job_id, result=result, verdict=run_verdict(result)).model_dump_json().encode()
+        headers = {
+            "Content-Type": "application/json",
+            SIGNATURE_HEADER: sign_payload(self.secret, body),
+            SUBMISSION_ID_HEADER: job_id,
+        }
+        try:
+            address = await self.check_url(url)
+        except CallbackUrlError as e:
+            logger.error(f"Not sending callback for job {job_id}: {e}")
+            return False
+        target, extensions = url, {}
+        if address is not None:
+            # Connect to the address just checked, so a second DNS lookup can't be pointed elsewhere;
+            # the Host header and TLS server name still carry the URL's own host
+            parsed = urlsplit(url)
+            target = _with_address(parsed, address)
+            headers["Host"] = parsed.netloc.rpartition("@")[2]
+            extensions = {"sni_hostname": parsed.hostname}
+        for attempt in range(1, self.attempts + 1):
+            try:
+                async with httpx.AsyncClient(timeout=self.timeout_seconds) as client:
+                    response = await client.post(target, content=body, headers=headers, extensions=extensions)
+            except httpx.HTTPError as e:
+                error = str(e) or type(e).__name__
+            else:
+                if 200 <= response.status_code < 300:
+                    return True
+                if response.status_code < 500 and response.status_code not in RETRYABLE_STATUS_CODES:
+                    logger.warning(f"Callback for job {job_id} rejected with HTTP {response.status_code}")
+                    return False
+                error = f"HTTP {response.status_code}"
+            if attempt < self.attempts:
+                delay = self.backoff_seconds * 2 ** (attempt - 1)
+                logger.warning(f"Callback for job {job_id} failed ({error}); retrying in {delay:g}s")
+                await asyncio.sleep(delay)
+        logger.error(f"Giving up on callback for job {job_id} after {self.attempts} attempts: {error}")
+        return False
+
+
+def _with_address(parsed: SplitResult, address: str) -> str:
+    host = f"[{address}]" if ":" in address else address
+    netloc = f"{host}:{parsed.port}" if parsed.port else host
+    return urlunsplit(parsed._replace(netloc=netloc))
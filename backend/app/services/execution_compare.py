@@ -0,0 +1,100 @@
+import math
+import re
+from typing import List, Optional, Tuple
+
+from app.schemas.execution import CompareMode, OutputDiff
+
+# Allowed difference between numeric tokens in FLOAT_TOLERANCE mode, both absolute and relative
+DEFAULT_FLOAT_EPSILON = 1e-6
+
+# Plain decimal or scientific notation; float() alone would also accept "nan", "inf" and "1_000"
+NUMBER_PATTERN = re.compile(r"^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$")
+
+
+def compare_output(
+    expected: str,
+    actual: str,
+    mode: CompareMode = CompareMode.TRIM_TRAILING_WHITESPACE,
+    epsilon: float = DEFAULT_FLOAT_EPSILON
+) -> Optional[OutputDiff]:
+    """
+    Compare program output with the expected output.
+
+    Returns None when they match under the given mode, otherwise an
+    OutputDiff describing the first mismatched line (and token, for the
+    token-based modes).
+    """
+    if mode in (CompareMode.TOKEN_WISE, CompareMode.FLOAT_TOLERANCE):
+        return _compare_tokens(expected, actual, mode, epsilon)
+    return _compare_lines(_lines(expected, mode), _lines(actual, mode))
+
+
+def _lines(text: str, mode: CompareMode) -> List[str]:
+    if mode == CompareMode.EXACT:
+        return text.split("\n")
+    if mode == CompareMode.IGNORE_TRAILING_NEWLINES:
+        return text.rstrip("\r\n").split("\n")
+    lines = [line.rstrip() for line in text.splitlines()]
+    while lines and not lines[-1]:
+        lines.pop()
+    return lines
+
+
+def _compare_lines(expected: List[str], actual: List[str]) -> Optional[OutputDiff]:
+    for index in range(max(len(expected), len(actual))):
+        want = expected[index] if index < len(expected) else None
+        got = actual[index] if index < len(actual) else None
+        if want != got:
+            return OutputDiff(
+                line=index + 1,
+                expected=want,
+                actual=got,
+                message=f"Line {index + 1}: {_describe(want, got)}"
+            )
+    return None
+
+
+def _tokens(text: str) -> List[Tuple[int, int, str]]:
+    """(line, token index within the line, token) for every whitespace-separated token."""
+    return [
+        (line_no, token_no, token)
+        for line_no, line in enumerate(text.splitlines(), 1)
+        for token_no, token in enumerate(line.split(), 1)
+    ]
+
+
+def _compare_tokens(expected: str, actual: str, mode: CompareMode, epsilon: float) -> Optional[OutputDiff]:
+    expected_tokens, actual_tokens = _tokens(expected), _tokens(actual)
+    for index in range(max(len(expected_tokens), len(actual_tokens))):
+        want = expected_tokens[index] if index < len(expected_tokens) else None
+        got = actual_tokens[index] if index < len(actual_tokens) else None
+        if want and got and _tokens_equal(want[2], got[2], mode, epsilon):
+            continue
+        # Point at the program's output where there is some, otherwise where it should have been
+        line, token, _ = got or want
+        return OutputDiff(
+            line=line,
+            token=token,
+            expected=want[2] if want else None,
+            actual=got[2] if got else None,
+            message=f"Line {line}, token {token}: {_describe(want and want[2], got and got[2])}"
+        )
+    return None
+
+
+def _tokens_equal(expected: str, actual: str, mode: CompareMode, epsilon: float) -> bool:
+    if expected == actual:
+        return True
+    if mode != CompareMode.FLOAT_TOLERANCE:
+        return False
+    if not (NUMBER_PATTERN.match(expected) and NUMBER_PATTERN.match(actual)):
+        return False
+    return math.isclose(float(expected), float(actual), rel_tol=epsilon, abs_tol=epsilon)
+
+
+def _describe(expected: Optional[str], actual: Optional[str]) -> str:
+    if actual is None:
+        return f"expected {expected!r}, got end of output"
+    if expected is None:
+        return f"expected end of output, got {actual!r}"
+    return f"expected {expected!r}, got {actual!r}"
@@ -0,0 +1,93 @@
+import asyncio
+import hashlib
+import json
+import time
+from collections import OrderedDict
+from typing import Awaitable, Callable, Tuple, TypeVar
+
+from pydantic import BaseModel
+
+from app.core.config import settings
+from app.schemas.execution import ExecutionStatus
+
+T = TypeVar("T")
+
+
+class IdempotencyKeyReusedError(Exception):
+    """Raised when a key comes back with a different request than the one it was first sent with."""
+
+
+def request_fingerprint(request: BaseModel) -> str:
+    """Hash of a request's full contents, to tell a retry from a different request under the same key."""
+    return hashlib.sha256(json.dumps(request.model_dump(mode="json"), sort_keys=True).encode()).hexdigest()
+
+
+class IdempotencyKeys:
+    """
+    Collapses submissions repeated under one Idempotency-Key into a single execution.
+
+    The first request with a key starts the work; later ones with the same
+    key, whether it's still running or already done, wait for and return
+    the same result. Keys expire ttl_seconds after they were first used;
+    once max_entries keys are held, the oldest is forgotten. Work that
+    raises or ends in an internal error isn't remembered, so a retry runs
+    it again. Entries are held in memory, so keys only collapse requests
+    served by the same process.
+    """
+
+    def __init__(
+        self,
+        ttl_seconds: float = 3600,
+        max_entries: int = 10000,
+        clock: Callable[[], float] = time.monotonic
+    ):
+        self.ttl_seconds = ttl_seconds
+        self.max_entries = max_entries
+        self.clock = clock
+        self._entries: "OrderedDict[str, Tuple[float, str, asyncio.Future]]" = OrderedDict()
+
+    async def run(self, key: str, fingerprint: str, start: Callable[[], Awaitable[T]]) -> T:
+        """Result of start() for the first request with this key, shared with every repeat of it."""
+        self._expire()
+        entry = self._entries.get(key)
+        if entry is not None:
+            _, first_fingerprint, task = entry
+            if first_fingerprint != fingerprint:
+                raise IdempotencyKeyReusedError("Idempotency-Key was already used for a different request")
+        else:
+            task = asyncio.ensure_future(start())
+            self._entries[key] = (self.clock(), fingerprint, task)
+            task.add_done_callback(lambda done: self._forget_failed(key, done))
+            while len(self._entries) > self.max_entries:
+                self._entries.popitem(last=False)
+        # A caller that disconnects mustn't cancel the work the others are waiting on
+        return await asyncio.shield(task)
+
+    def _forget_failed(self, key: str, task: asyncio.Future):
+        entry = self._entries.get(key)
+        if entry is None or entry[2] is not task:
+            return
+        # Executors report their own faults as results, which are as worth retrying as an exception
+        if task.cancelled() or task.exception() is not None or (
+            getattr(task.result(), "status", None) == ExecutionStatus.INTERNAL_ERROR
+        ):
+            del self._entries[key]
+
+    def _expire(self):
+        # Entries are kept in the order they were made, so expired ones are all at the front
+        now = self.clock()
+        while self._entries:
+            key, (created_at, _, _) = next(iter(self._entries.items()))
+            if now - created_at < self.ttl_seconds:
+                break
+            del self._entries[key]
+
+    def __len__(self) -> int:
+        return len(self._entries)
+
+
+# Global instance
+idempotency_keys = IdempotencyKeys(
+    ttl_seconds=settings.execution_idempotency_ttl_seconds,
+    max_entries=settings.execution_idempotency_max_entries
+)
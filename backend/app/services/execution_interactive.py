@@ -0,0 +1,309 @@
+import asyncio
+import socket
+import threading
+import time
+from typing import Callable, Dict, Optional
+
+from app.core.execution_languages import InvalidFilenameError, InvalidSubmissionError
+from app.schemas.execution import ExecutionStatus, InteractiveResult, RunRequest
+from app.services.execution import (
+    DEFAULT_MAX_OUTPUT_BYTES,
+    EXECUTION_DEADLINE_GRACE_SECONDS,
+    CodeExecutionService,
+    EmptySourceError,
+    execution_service,
+)
+from app.services.execution_logging import COMPILE_FINISHED, COMPILE_STARTED, RUN_FINISHED, RUN_STARTED
+from app.services.execution_sandbox import STDERR_FRAME, Sandbox, read_frames
+from app.services.execution_signals import exit_signal, signal_reason
+
+DEFAULT_TURN_TIMEOUT_SECONDS = 2.0
+
+
+class InteractionError(Exception):
+    """The program stopped taking part in the conversation; raised from session reads."""
+
+
+class InteractionTimeoutError(InteractionError):
+    """The program didn't answer within the turn timeout, or the session's overall deadline passed."""
+
+
+class ProgramExitedError(InteractionError):
+    """The program closed stdout before producing the next line."""
+
+
+class InteractiveSession:
+    """
+    Bidirectional connection to a program's stdin and stdout, driven by a judge.
+
+    send() writes a line to the program; receive() waits for the next line it
+    prints, for at most the turn timeout and never past the session deadline.
+    Output is read on a background thread so a silent program can't block
+    the judge. stderr is collected separately and never interleaved with
+    the conversation. close() drops the connection; the runner then removes
+    the sandbox, so a judge can stop at any turn.
+    """
+
+    def __init__(
+        self,
+        sandbox: Sandbox,
+        command: str,
+        turn_timeout_seconds: float,
+        deadline: float,
+        environment: Optional[Dict[str, str]] = None,
+        max_output_bytes: int = DEFAULT_MAX_OUTPUT_BYTES
+    ):
+        self.sandbox = sandbox
+        self.command = command
+        self.turn_timeout_seconds = turn_timeout_seconds
+        self.deadline = deadline
+        self.environment = environment
+        self.max_output_bytes = max_output_bytes
+        self.turns = 0
+        self.output_limit_exceeded = False
+        self._exec_id = None
+        self._socket = None
+        self._stdout = bytearray()
+        self._stderr = bytearray()
+        self._eof = False
+        self._changed = threading.Condition()
+        self._reader = None
+
+    def start(self):
+        api = self.sandbox.docker_client.api
+        self._exec_id = api.exec_create(
+            self.sandbox.container.id,
+            self.command,
+            stdin=True,
+            stdout=True,
+            stderr=True,
+            user=Sandbox.USER,
+            workdir=Sandbox.WORKDIR,
+            environment=self.environment
+        )["Id"]
+        attached = api.exec_start(self._exec_id, socket=True)
+        # docker-py hands back a SocketIO wrapper; writes need the socket underneath
+        self._socket = getattr(attached, "_sock", attached)
+        self._reader = threading.Thread(target=self._read, daemon=True)
+        self._reader.start()
+        return self
+
+    def send(self, line: str):
+        """Write one line to the program's stdin; a turn is counted for each."""
+        if not line.endswith("\n"):
+            line += "\n"
+        try:
+            self._socket.sendall(line.encode("utf-8"))
+        except OSError as e:
+            raise ProgramExitedError(f"Program stopped reading input: {e}") from None
+        self.turns += 1
+
+    def receive(self) -> str:
+        """The next line the program prints, without its newline."""
+        turn_deadline = min(time.monotonic() + self.turn_timeout_seconds, self.deadline)
+        with self._changed:
+            while b"\n" not in self._stdout:
+                if self._eof:
+                    raise ProgramExitedError("Program exited before answering")
+                remaining = turn_deadline - time.monotonic()
+                if remaining <= 0:
+                    if turn_deadline == self.deadline:
+                        raise InteractionTimeoutError("Interaction timed out")
+                    raise InteractionTimeoutError(f"No answer within {self.turn_timeout_seconds:g}s")
+                self._changed.wait(remaining)
+            line, _, rest = bytes(self._stdout).partition(b"\n")
+            self._stdout[:] = rest
+        return line.decode("utf-8", errors="replace").rstrip("\r")
+
+    def close_stdin(self):
+        """Signal end of input, for programs that read until EOF after the last turn."""
+        try:
+            self._socket.shutdown(socket.SHUT_WR)
+        except OSError:
+            pass
+
+    @property
+    def stderr(self) -> str:
+        with self._changed:
+            return bytes(self._stderr).decode("utf-8", errors="replace")
+
+    def exit_code(self) -> Optional[int]:
+        """The program's exit code, or None while it is still running."""
+        if self._exec_id is None:
+            return None
+        return self.sandbox.docker_client.api.exec_inspect(self._exec_id).get("ExitCode")
+
+    def close(self):
+        if self._socket is not None:
+            try:
+                self._socket.close()
+            except OSError:
+                pass
+        with self._changed:
+            self._eof = True
+            self._changed.notify_all()
+
+    def _read(self):
+        captured = 0
+        try:
+            for stream, data in read_frames(self._socket):
+                if captured + len(data) > self.max_output_bytes:
+                    self.output_limit_exceeded = True
+                    break
+                captured += len(data)
+                with self._changed:
+                    (self._stderr if stream == STDERR_FRAME else self._stdout).extend(data)
+                    self._changed.notify_all()
+        except OSError:
+            pass  # closed by close()
+        finally:
+            with self._changed:
+                self._eof = True
+                self._changed.notify_all()
+
+
+class InteractiveRunner:
+    """
+    Runs interactive submissions, where a judge talks to the program turn by turn.
+
+    The judge is called with an InteractiveSession once the program has
+    started, and returns whether the submission is accepted; returning
+    early ends the session. It runs on a worker thread, so it can use the
+    session's blocking send() and receive() directly. Each receive() is
+    bounded by turn_timeout_seconds and the whole conversation by the
+    request's timeout (or the language default).
+    """
+
+    def __init__(self, service: Optional[CodeExecutionService] = None):
+        self.service = service or execution_service
+
+    async def run(
+        self,
+        request: RunRequest,
+        judge: Callable[[InteractiveSession], bool],
+        turn_timeout_seconds: float = DEFAULT_TURN_TIMEOUT_SECONDS
+    ) -> InteractiveResult:
+        service = self.service
+        log = service._submission_logger(request.language)
+        start_time = time.time()
+        try:
+            config = service.validate(request)
+        except (EmptySourceError, InvalidFilenameError) as e:
+            return InteractiveResult(status=ExecutionStatus.COMPILATION_ERROR, error_message=str(e))
+        except InvalidSubmissionError as e:
+            return InteractiveResult(status=ExecutionStatus.INVALID_SUBMISSION, error_message=str(e))
+
+        timeout_seconds = service._timeout_for(request, config)
+        filename, template_args, error = service._resolve_source(
+            request.code, request.language, config, request.files, request.entry_point, request.filename,
+            binary=request.binary
+        )
+        if error:
+            return InteractiveResult(status=ExecutionStatus.COMPILATION_ERROR, stderr=error, error_message=error)
+        source_files = service._source_files(request.code, filename, config, request.files)
+        environment = service._submission_env(config, request.env)
+
+        try:
+            # Never pooled: a session abandoned mid-turn leaves the program running
+            async with service._sandbox_for(
+                request.language, config, request.resource_limits, request.memory_limit_bytes,
+                request.cpu_quota, log=log, allow_pool=False
+            ) as sandbox:
+                if request.data_files:
+                    await asyncio.to_thread(sandbox.write_data_files, request.data_files)
+                write_files = service._write_files_command(source_files)
+                if request.binary is not None:
+                    await asyncio.to_thread(sandbox.write_executable, template_args["output"], request.binary)
+                    write_files = "true"
+                elif config.is_compiled:
+                    build_cmd = service._build_command(config, template_args, request.compile_args)
+                    log.event(COMPILE_STARTED, command=build_cmd)
+                    compiled = await service._exec_with_deadline(
+                        sandbox,
+                        f"sh -c '{write_files} && {build_cmd}'",
+                        config.compile_timeout,
+                        max_output_bytes=service._max_output_for(request),
+                        environment=service._build_env(config, environment, request.compile_args),
+                        log=log
+                    )
+                    log.event(COMPILE_FINISHED, exit_code=compiled.exit_code, timed_out=compiled.timed_out)
+                    if compiled.timed_out or compiled.exit_code != 0:
+                        return InteractiveResult(
+                            status=ExecutionStatus.COMPILATION_ERROR,
+                            stderr="".join(part for part in (compiled.stderr, compiled.stdout) if part),
+                            exit_code=compiled.exit_code,
+                            duration_ms=int((time.time() - start_time) * 1000),
+                            timed_out=compiled.timed_out,
+                            error_message="Compilation timed out" if compiled.timed_out else "Compilation failed"
+                        )
+                    write_files = "true"
+
+                run_cmd = config.run_cmd.format(**template_args)
+                log.event(RUN_STARTED, command=run_cmd, timeout_seconds=timeout_seconds, interactive=True)
+                session = InteractiveSession(
+                    sandbox,
+                    f"sh -c '{write_files} && exec timeout -k {service.kill_grace_seconds:g}s {timeout_seconds:g}s {run_cmd}'",
+                    turn_timeout_seconds,
+                    deadline=time.monotonic() + timeout_seconds,
+                    environment=environment,
+                    max_output_bytes=service._max_output_for(request)
+                )
+                result = await self._judge(session, judge, timeout_seconds, start_time)
+                log.event(
+                    RUN_FINISHED,
+                    exit_code=result.exit_code,
+                    turns=result.turns,
+                    accepted=result.accepted,
+                    timed_out=result.timed_out
+                )
+                return result
+        except Exception as e:
+            log.error(f"Interactive execution failed: {str(e)}")
+            return InteractiveResult(status=ExecutionStatus.INTERNAL_ERROR, error_message=f"Internal error: {str(e)}")
+
+    async def _judge(
+        self,
+        session: InteractiveSession,
+        judge: Callable[[InteractiveSession], bool],
+        timeout_seconds: float,
+        start_time: float
+    ) -> InteractiveResult:
+        status, accepted, error_message = ExecutionStatus.SUCCESS, False, None
+        await asyncio.to_thread(session.start)
+        try:
+            accepted = bool(await asyncio.wait_for(
+                asyncio.to_thread(judge, session),
+                timeout=timeout_seconds + self.service.kill_grace_seconds + EXECUTION_DEADLINE_GRACE_SECONDS
+            ))
+        except (InteractionTimeoutError, asyncio.TimeoutError) as e:
+            status, error_message = ExecutionStatus.TIMEOUT, str(e) or "Interaction timed out"
+        except ProgramExitedError as e:
+            error_message = str(e)
+        except Exception as e:
+            status, error_message = ExecutionStatus.INTERNAL_ERROR, f"Judge failed: {e}"
+        finally:
+            # Unblocks a judge still waiting in receive(); the sandbox is removed right after
+            session.close()
+
+        exit_code = await asyncio.to_thread(session.exit_code)
+        killed_by = None
+        if session.output_limit_exceeded:
+            status, accepted = ExecutionStatus.OUTPUT_LIMIT_EXCEEDED, False
+            error_message = f"Output exceeded {session.max_output_bytes} bytes"
+        elif status == ExecutionStatus.SUCCESS and exit_code not in (None, 0):
+            status = self.service._classify_exit(exit_code)
+            accepted = False
+            killed_by = exit_signal(exit_code) if status == ExecutionStatus.RUNTIME_ERROR else None
+            if killed_by:
+                error_message = signal_reason(killed_by)
+        return InteractiveResult(
+            status=status,
+            accepted=accepted and status == ExecutionStatus.SUCCESS,
+            turns=session.turns,
+            stderr=session.stderr,
+            exit_code=exit_code,
+            signal=killed_by.name if killed_by else None,
+            duration_ms=int((time.time() - start_time) * 1000),
+            timed_out=status == ExecutionStatus.TIMEOUT,
+            error_message=error_message
+        )
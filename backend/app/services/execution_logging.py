@@ -0,0 +1,42 @@
+import logging
+from typing import Any, Dict
+
+# Execution phases logged for every submission, in the order they happen
+SANDBOX_CREATED = "sandbox_created"
+COMPILE_STARTED = "compile_started"
+COMPILE_FINISHED = "compile_finished"
+RUN_STARTED = "run_started"
+RUN_FINISHED = "run_finished"
+SANDBOX_CLEANED_UP = "sandbox_cleaned_up"
+
+
+class SubmissionLogger(logging.LoggerAdapter):
+    """
+    Logger for one submission's execution.
+
+    Every record carries submission_id, language and (for events) phase as
+    record attributes, with all structured details in record.fields for JSON
+    handlers. They are also appended to the message as key=value pairs so
+    plain text logs from concurrent submissions can still be told apart.
+    """
+
+    def __init__(self, logger: logging.Logger, submission_id: str, language: str):
+        super().__init__(logger, {"submission_id": submission_id, "language": language})
+
+    @property
+    def submission_id(self) -> str:
+        return self.extra["submission_id"]
+
+    def process(self, msg, kwargs):
+        fields = {**self.extra, **kwargs.pop("fields", {})}
+        # Arbitrary fields stay in record.fields; as attributes they could clash with LogRecord's own
+        kwargs["extra"] = {**kwargs.get("extra", {}), **self.extra, "fields": fields}
+        return f"{msg} {format_fields(fields)}", kwargs
+
+    def event(self, phase: str, level: int = logging.INFO, **fields: Any):
+        """Log an execution phase with its details, e.g. event(RUN_FINISHED, exit_code=0)."""
+        self.log(level, phase, fields=fields, extra={"phase": phase})
+
+
+def format_fields(fields: Dict[str, Any]) -> str:
+    return " ".join(f"{key}={value}" for key, value in fields.items() if value is not None)
@@ -0,0 +1,61 @@
+from typing import Optional
+
+from prometheus_client import REGISTRY, CollectorRegistry, Counter, Gauge, Histogram
+
+from app.schemas.execution import RunResult
+
+# Compiles and runs range from a few milliseconds to the 60 second timeout cap
+DURATION_BUCKETS = (0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60)
+
+
+class ExecutionMetrics:
+    """
+    Prometheus metrics for the executor and scheduler.
+
+    Registered on the default registry, which /metrics serves; tests pass
+    their own registry so each gets fresh counters.
+    """
+
+    def __init__(self, registry: Optional[CollectorRegistry] = REGISTRY):
+        self.submissions = Counter(
+            "codehub_execution_submissions",
+            "Runs finished, by language and verdict (the run's execution status)",
+            ["language", "verdict"],
+            registry=registry
+        )
+        self.compile_duration = Histogram(
+            "codehub_execution_compile_duration_seconds",
+            "Time spent in the compile step",
+            ["language"],
+            buckets=DURATION_BUCKETS,
+            registry=registry
+        )
+        self.run_duration = Histogram(
+            "codehub_execution_run_duration_seconds",
+            "Time spent running the program",
+            ["language"],
+            buckets=DURATION_BUCKETS,
+            registry=registry
+        )
+        self.active_containers = Gauge(
+            "codehub_execution_active_containers",
+            "Sandbox containers currently running a submission",
+            registry=registry
+        )
+        self.queue_rejections = Counter(
+            "codehub_execution_queue_rejections",
+            "Jobs refused by the scheduler, by reason (queue_full, shutting_down)",
+            ["reason"],
+            registry=registry
+        )
+
+    def record_run(self, language: str, result: RunResult):
+        language = getattr(language, "value", language)
+        self.submissions.labels(language=language, verdict=result.status.value).inc()
+        if result.compile_duration_ms:
+            self.compile_duration.labels(language=language).observe(result.compile_duration_ms / 1000)
+        if result.run_duration_ms:
+            self.run_duration.labels(language=language).observe(result.run_duration_ms / 1000)
+
+
+execution_metrics = ExecutionMetrics()
@@ -0,0 +1,124 @@
+import logging
+import threading
+from collections import defaultdict
+from typing import Callable, Dict, List
+
+from app.services.execution_sandbox import Sandbox
+
+logger = logging.getLogger(__name__)
+
+# Run as root: kills whatever a submission left running, even detached with setsid or nohup,
+# then wipes its writable paths. Kill victims linger as zombies of the idle init process, which
+# never reaps them, so it only succeeds if nothing but init and this shell was left to kill.
+RESET_COMMAND = (
+    "sh -c 'kill -KILL -1 2>/dev/null; find /app/code /tmp /dev/shm -mindepth 1 -delete "
+    "&& set -- /proc/[0-9]* && [ $# -eq 2 ]'"
+)
+
+
+class ContainerPool:
+    """
+    Keeps idle, already-started sandboxes per language so runs skip container startup.
+
+    Sandboxes are wiped and have their peak memory reset between uses, and
+    are discarded rather than reused if they were killed, had processes left
+    running, fail either reset, have served max_uses submissions, or were
+    started before their language was drained.
+    """
+
+    def __init__(
+        self,
+        size: int,
+        sandbox_factory: Callable[[str], Sandbox],
+        max_uses: int = 50
+    ):
+        self.size = size
+        self.sandbox_factory = sandbox_factory
+        self.max_uses = max_uses
+        self._idle: Dict[str, List[Sandbox]] = defaultdict(list)
+        self._uses: Dict[int, int] = {}
+        self._generations: Dict[str, int] = defaultdict(int)
+        self._started_in: Dict[int, int] = {}
+        self._lock = threading.Lock()
+
+    def warm(self, languages: List[str]):
+        """Pre-start idle sandboxes for each language up to the pool size."""
+        for language in languages:
+            while self.idle_count(language) < self.size:
+                sandbox = self._start(language)
+                with self._lock:
+                    self._idle[language].append(sandbox)
+
+    def acquire(self, language: str) -> Sandbox:
+        """Hand out an idle sandbox for the language, starting one if none are idle."""
+        with self._lock:
+            sandbox = self._idle[language].pop() if self._idle[language] else None
+        if sandbox is None:
+            sandbox = self._start(language)
+        sandbox.language = language
+        sandbox.record_memory_baseline()
+        return sandbox
+
+    def release(self, sandbox: Sandbox):
+        """Return a sandbox to the pool, or remove it if it can't be safely reused."""
+        language = getattr(sandbox, "language", None)
+        uses = self._uses.get(id(sandbox), 0) + 1
+        self._uses[id(sandbox)] = uses
+
+        if (
+            language is None
+            or self._started_in.get(id(sandbox)) != self._generations[language]
+            or sandbox.killed
+            or uses >= self.max_uses
+            or not self._reset(sandbox)
+        ):
+            self._discard(sandbox)
+            return
+
+        with self._lock:
+            if len(self._idle[language]) < self.size:
+                self._idle[language].append(sandbox)
+                return
+        self._discard(sandbox)
+
+    def idle_count(self, language: str) -> int:
+        with self._lock:
+            return len(self._idle[language])
+
+    def drain(self, language: str):
+        """Remove a language's idle sandboxes; ones in use are removed when released."""
+        with self._lock:
+            self._generations[language] += 1
+            idle = self._idle.pop(language, [])
+        for sandbox in idle:
+            self._discard(sandbox)
+
+    def close(self):
+        """Remove every idle sandbox."""
+        with self._lock:
+            idle = [sandbox for sandboxes in self._idle.values() for sandbox in sandboxes]
+            self._idle.clear()
+        for sandbox in idle:
+            self._discard(sandbox)
+
+    def _start(self, language: str) -> Sandbox:
+        generation = self._generations[language]
+        sandbox = self.sandbox_factory(language).start()
+        self._uses[id(sandbox)] = 0
+        self._started_in[id(sandbox)] = generation
+        return sandbox
+
+    def _reset(self, sandbox: Sandbox) -> bool:
+        try:
+            if sandbox.exec(RESET_COMMAND, user="root").exit_code != 0:
+                return False
+        except Exception as e:
+            logger.warning(f"Failed to reset pooled container: {e}")
+            return False
+        # Otherwise the next submission would be reported this one's peak
+        return sandbox.reset_memory_peak()
+
+    def _discard(self, sandbox: Sandbox):
+        self._uses.pop(id(sandbox), None)
+        self._started_in.pop(id(sandbox), None)
+        sandbox.remove()
@@ -0,0 +1,79 @@
+import base64
+import json
+from typing import Optional
+
+from docker.errors import ImageNotFound
+
+from app.schemas.execution import ReplayBundle, RunRequest, RunResult
+from app.services.execution import CodeExecutionService, execution_service
+
+REPLAY_FORMAT_VERSION = 1
+
+
+class ReplayError(Exception):
+    """Raised when a bundle can't be re-run exactly as it was captured."""
+
+
+def export_bundle(request: RunRequest, service: Optional[CodeExecutionService] = None) -> ReplayBundle:
+    """
+    Capture everything needed to re-run a submission identically.
+
+    The toolchain version is resolved to the one the language defaults to,
+    and the image to its digest, so later changes to either don't alter the
+    replay. Raises InvalidSubmissionError for requests validate() rejects.
+    """
+    service = service or execution_service
+    config = service.validate(request)
+    pinned = request.model_copy(update={"version": request.version or config.version, "cacheable": False})
+    return ReplayBundle(
+        format_version=REPLAY_FORMAT_VERSION,
+        request=pinned,
+        image=config.image,
+        image_digest=image_digest(service.docker_client, config.image)
+    )
+
+
+def image_digest(docker_client, image: str) -> str:
+    """Repo digest of a local image, falling back to its image ID for locally built ones."""
+    found = docker_client.images.get(image)
+    repo_digests = found.attrs.get("RepoDigests") or []
+    return repo_digests[0] if repo_digests else found.id
+
+
+def dump_bundle(bundle: ReplayBundle) -> str:
+    """Serialize a bundle as JSON; the same submission always gives the same text."""
+    fields = bundle.model_dump(mode="json")
+    if bundle.request.data_files:
+        # Data files may be binary; written as standard base64 whatever pydantic's bytes encoding is
+        fields["request"]["data_files"] = {
+            path: base64.b64encode(content).decode("ascii") for path, content in bundle.request.data_files.items()
+        }
+    return json.dumps(fields, sort_keys=True, indent=2) + "\n"
+
+
+def load_bundle(data: str) -> ReplayBundle:
+    """Parse a bundle written by dump_bundle."""
+    fields = json.loads(data)
+    if fields.get("format_version") != REPLAY_FORMAT_VERSION:
+        raise ReplayError(f"Unsupported replay bundle format: {fields.get('format_version')!r}")
+    data_files = fields.get("request", {}).get("data_files")
+    if data_files:
+        fields["request"]["data_files"] = {path: base64.b64decode(content) for path, content in data_files.items()}
+    return ReplayBundle.model_validate(fields)
+
+
+async def replay(bundle: ReplayBundle, service: Optional[CodeExecutionService] = None) -> RunResult:
+    """
+    Re-run a captured submission on the image it originally ran on.
+
+    Always executes, bypassing the result cache. Raises ReplayError if that
+    exact image isn't available locally; pull it by digest first.
+    """
+    service = service or execution_service
+    try:
+        service.docker_client.images.get(bundle.image_digest)
+    except ImageNotFound:
+        raise ReplayError(
+            f"Image {bundle.image_digest} ({bundle.image}) is not available; pull it to replay this bundle"
+        ) from None
+    return await service._run_request(bundle.request, image=bundle.image_digest)
@@ -0,0 +1,129 @@
+import threading
+from abc import ABC, abstractmethod
+from datetime import datetime, timezone
+from typing import Callable, Dict, Optional
+
+from sqlalchemy.orm import Session
+
+from app.core.database import SessionLocal
+from app.models.execution_result import SubmissionResult
+from app.schemas.execution import ExecutionStatus, RunResult, StoredRunResult
+
+# Output kept per stream in stored results; full output stays on the live RunResult
+STORED_OUTPUT_CHARS = 64 * 1024
+
+
+def truncate_output(result: RunResult) -> RunResult:
+    """Copy of result with stdout and stderr cut to STORED_OUTPUT_CHARS."""
+    return result.model_copy(update={
+        "stdout": result.stdout[:STORED_OUTPUT_CHARS],
+        "stderr": result.stderr[:STORED_OUTPUT_CHARS],
+    })
+
+
+class ResultStore(ABC):
+    """Persists completed submission results so they outlive the request that ran them."""
+
+    @abstractmethod
+    def save(self, submission_id: str, result: RunResult, language: str, user_id: Optional[int] = None):
+        """Store a completed result, replacing any earlier one for the submission; user_id is who submitted it."""
+
+    @abstractmethod
+    def get(self, submission_id: str, user_id: Optional[int] = None) -> Optional[StoredRunResult]:
+        """The stored result for a submission, or None if there isn't one; with user_id, only if they submitted it."""
+
+
+class InMemoryResultStore(ResultStore):
+    """ResultStore kept in a dict, for tests and single-process development."""
+
+    def __init__(self):
+        self._results: Dict[str, StoredRunResult] = {}
+        self._lock = threading.Lock()
+
+    def save(self, submission_id: str, result: RunResult, language: str, user_id: Optional[int] = None):
+        stored = StoredRunResult(
+            submission_id=submission_id,
+            language=language,
+            user_id=user_id,
+            created_at=datetime.now(timezone.utc),
+            result=truncate_output(result)
+        )
+        with self._lock:
+            self._results[submission_id] = stored
+
+    def get(self, submission_id: str, user_id: Optional[int] = None) -> Optional[StoredRunResult]:
+        with self._lock:
+            stored = self._results.get(submission_id)
+        if stored is None or (user_id is not None and stored.user_id != user_id):
+            return None
+        return stored
+
+
+class PostgresResultStore(ResultStore):
+    """ResultStore backed by the submission_results table."""
+
+    def __init__(self, session_factory: Callable[[], Session] = SessionLocal):
+        self.session_factory = session_factory
+
+    def save(self, submission_id: str, result: RunResult, language: str, user_id: Optional[int] = None):
+        result = truncate_output(result)
+        db = self.session_factory()
+        try:
+            row = db.query(SubmissionResult).filter(
+                SubmissionResult.submission_id == submission_id
+            ).first()
+            if row is None:
+                row = SubmissionResult(submission_id=submission_id)
+                db.add(row)
+            row.language = language
+            row.user_id = user_id
+            row.status = result.status.value
+            row.stdout = result.stdout
+            row.stderr = result.stderr
+            row.exit_code = result.exit_code
+            row.signal = result.signal
+            row.timed_out = result.timed_out
+            row.error_message = result.error_message
+            row.duration_ms = result.duration_ms
+            row.compile_duration_ms = result.compile_duration_ms
+            row.run_duration_ms = result.run_duration_ms
+            row.memory_used_bytes = result.memory_used_bytes
+            db.commit()
+        except Exception:
+            db.rollback()
+            raise
+        finally:
+            db.close()
+
+    def get(self, submission_id: str, user_id: Optional[int] = None) -> Optional[StoredRunResult]:
+        db = self.session_factory()
+        try:
+            query = db.query(SubmissionResult).filter(
+                SubmissionResult.submission_id == submission_id
+            )
+            if user_id is not None:
+                query = query.filter(SubmissionResult.user_id == user_id)
+            row = query.first()
+            if row is None:
+                return None
+            return StoredRunResult(
+                submission_id=row.submission_id,
+                language=row.language,
+                user_id=row.user_id,
+                created_at=row.created_at,
+                result=RunResult(
+                    status=ExecutionStatus(row.status),
+                    stdout=row.stdout,
+                    stderr=row.stderr,
+                    exit_code=row.exit_code,
+                    signal=row.signal,
+                    timed_out=row.timed_out,
+                    error_message=row.error_message,
+                    duration_ms=row.duration_ms,
+                    compile_duration_ms=row.compile_duration_ms,
+                    run_duration_ms=row.run_duration_ms,
+                    memory_used_bytes=row.memory_used_bytes
+                )
+            )
+        finally:
+            db.close()
@@ -0,0 +1,487 @@
+import codecs
+import json
+import logging
+import struct
+import time
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Callable, Dict, Iterator, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+# Reads the container cgroup's peak memory and OOM-kill count (cgroup v2, then v1)
+MEMORY_PROBE_COMMAND = (
+    "sh -c '"
+    "cat /sys/fs/cgroup/memory.peak /sys/fs/cgroup/memory/memory.max_usage_in_bytes 2>/dev/null | head -n 1; "
+    "cat /sys/fs/cgroup/memory.events /sys/fs/cgroup/memory/memory.oom_control 2>/dev/null | grep -w oom_kill"
+    "'"
+)
+
+# Clears the cgroup v1 peak; fails on a read-only cgroup filesystem, and cgroup v2 has no reset seen by later reads
+MEMORY_PEAK_RESET_COMMAND = "sh -c 'echo 0 > /sys/fs/cgroup/memory/memory.max_usage_in_bytes'"
+
+# Bundled syscall filter: Docker's default allowlist less ptrace, personality and the like; anything unlisted fails
+DEFAULT_SECCOMP_PROFILE = str(Path(__file__).resolve().parents[2] / "docker" / "execution" / "seccomp.json")
+
+# A process attached to an exec socket gets its output in frames: stream (1 stdout, 2 stderr), 3 pad bytes, length
+EXEC_FRAME_HEADER = struct.Struct(">BxxxL")
+STDERR_FRAME = 2
+
+# Where snapshot_workdir() keeps the built workdir: a tmpfs only root can enter (/dev/shm is world-writable)
+SNAPSHOT_DIR = "/run/codehub"
+WORKDIR_SNAPSHOT = f"{SNAPSHOT_DIR}/workdir.tar"
+
+# Every container the executor creates carries these, so orphans can be found after a crash
+EXECUTION_LABEL = "codehub.execution"
+JOB_ID_LABEL = "codehub.job_id"
+
+# Daemon and transport errors worth retrying a container start for; anything else fails at once
+TRANSIENT_DOCKER_ERRORS = (
+    "connection reset",
+    "connection aborted",
+    "resource temporarily unavailable",
+    "broken pipe",
+    "i/o timeout",
+)
+
+
+def is_transient_docker_error(error: Exception) -> bool:
+    message = str(error).lower()
+    return any(fragment in message for fragment in TRANSIENT_DOCKER_ERRORS)
+
+
+def read_frames(sock) -> Iterator[Tuple[int, bytes]]:
+    """(stream, data) for each output frame from an attached exec socket, until it closes."""
+    while True:
+        header = _recv_exactly(sock, EXEC_FRAME_HEADER.size)
+        if header is None:
+            return
+        stream, size = EXEC_FRAME_HEADER.unpack(header)
+        data = _recv_exactly(sock, size)
+        if data is None:
+            return
+        yield stream, data
+
+
+def _recv_exactly(sock, size: int) -> Optional[bytes]:
+    data = b""
+    while len(data) < size:
+        chunk = sock.recv(size - len(data))
+        if not chunk:
+            return None
+        data += chunk
+    return data
+
+
+def load_seccomp_profile(path: str) -> str:
+    """
+    Read a seccomp JSON profile for SecurityOpt.
+
+    The Docker API takes the profile's contents rather than a path, so it
+    is returned re-serialized. Raises ValueError if the file is missing or
+    isn't a profile, so a typo never leaves sandboxes unfiltered.
+    """
+    try:
+        with open(path) as f:
+            profile = json.load(f)
+    except (OSError, json.JSONDecodeError) as e:
+        raise ValueError(f"Cannot load seccomp profile {path}: {e}") from None
+    if not isinstance(profile, dict) or "defaultAction" not in profile:
+        raise ValueError(f"Invalid seccomp profile {path}: no defaultAction")
+    return json.dumps(profile, separators=(",", ":"))
+
+
+@dataclass
+class ExecOutput:
+    """
+    Raw outcome of a single command executed inside a sandbox.
+
+    Output is kept as the bytes the command wrote; stdout and stderr decode
+    it as UTF-8, replacing invalid bytes, so they never fail.
+    """
+    exit_code: Optional[int]
+    stdout_bytes: bytes
+    stderr_bytes: bytes
+    duration_ms: int
+    output_limit_exceeded: bool = False
+    timed_out: bool = False  # killed from the host; stdout and stderr are what it wrote until then
+
+    @property
+    def stdout(self) -> str:
+        return _decode(self.stdout_bytes)
+
+    @property
+    def stderr(self) -> str:
+        return _decode(self.stderr_bytes)
+
+
+@dataclass
+class MemoryUsage:
+    peak_bytes: int = 0
+    oom_kills: int = 0
+    state_oom_killed: bool = False  # Docker's State.OOMKilled flag, set on the cgroup's OOM event
+    below_baseline: bool = False  # peak_bytes is 0 because earlier commands set a high-water mark this never passed
+
+    @property
+    def oom_killed(self) -> bool:
+        return self.oom_kills > 0 or self.state_oom_killed
+
+
+class Sandbox:
+    """
+    A single execution container kept idle while commands are exec'd into it.
+
+    Compilation and the program run happen as separate execs in the same
+    container, so build artifacts are shared while each phase's stdout and
+    stderr are captured independently. Starting the container is retried
+    with exponential backoff, up to start_attempts tries, when Docker fails
+    with a transient error.
+    """
+
+    WORKDIR = "/app/code"
+    DATA_DIR = "/app/data"
+    USER = "coderunner"
+
+    def __init__(
+        self,
+        docker_client,
+        image: str,
+        start_attempts: int = 3,
+        retry_backoff_seconds: float = 0.1,
+        **container_options
+    ):
+        self.docker_client = docker_client
+        self.image = image
+        self.start_attempts = start_attempts
+        self.retry_backoff_seconds = retry_backoff_seconds
+        self.container_options = container_options
+        self.container = None
+        self.killed = False
+        self._oom_kill_baseline = 0
+        self._peak_baseline = 0
+        self._state_oom_killed_baseline = False
+        # Output of the exec in progress, readable from other threads if it has to be abandoned
+        self._chunks = {"stdout": [], "stderr": []}
+        self._exec_started = time.time()
+
+    def start(self):
+        """Create the container with an idle init process."""
+        for attempt in range(1, self.start_attempts + 1):
+            try:
+                self.container = self.docker_client.containers.run(
+                    self.image,
+                    command="sleep infinity",
+                    detach=True,
+                    **self.container_options
+                )
+                return self
+            except Exception as e:
+                if attempt == self.start_attempts or not is_transient_docker_error(e):
+                    raise
+                delay = self.retry_backoff_seconds * 2 ** (attempt - 1)
+                logger.warning(
+                    f"Transient Docker error starting container (attempt {attempt}/{self.start_attempts}), "
+                    f"retrying in {delay:.1f}s: {e}"
+                )
+                time.sleep(delay)
+
+    def exec(
+        self,
+        command,
+        on_output: Optional[Callable[[str, bytes], None]] = None,
+        max_output_bytes: Optional[int] = None,
+        environment: Optional[Dict[str, str]] = None,
+        user: Optional[str] = None
+    ) -> ExecOutput:
+        """
+        Run a command in the container and wait for it to finish.
+
+        on_output, if given, is called with ("stdout" | "stderr", data) for each
+        chunk as it arrives; an exception from it aborts the exec. Once stdout
+        and stderr together exceed max_output_bytes, reading stops, the output
+        is truncated to the limit and the container is killed. environment is
+        added to the image's environment for this exec only. Commands run as
+        the submission's user unless user says otherwise.
+        """
+        api = self.docker_client.api
+        start_time = self._exec_started = time.time()
+
+        exec_id = api.exec_create(
+            self.container.id,
+            command,
+            stdout=True,
+            stderr=True,
+            user=user or self.USER,
+            workdir=self.WORKDIR,
+            environment=environment
+        )["Id"]
+
+        chunks = self._chunks = {"stdout": [], "stderr": []}
+        captured = 0
+        limit_exceeded = False
+        for stdout_chunk, stderr_chunk in api.exec_start(exec_id, stream=True, demux=True):
+            for stream, data in (("stdout", stdout_chunk), ("stderr", stderr_chunk)):
+                if not data:
+                    continue
+                if max_output_bytes is not None and captured + len(data) > max_output_bytes:
+                    data = data[:max_output_bytes - captured]
+                    limit_exceeded = True
+                captured += len(data)
+                if data:
+                    chunks[stream].append(data)
+                    if on_output:
+                        on_output(stream, data)
+                if limit_exceeded:
+                    break
+            if limit_exceeded:
+                break
+
+        if limit_exceeded:
+            # Stop the writer rather than leave it blocked on a stream nobody reads
+            self.kill()
+            exit_code = None
+        else:
+            exit_code = api.exec_inspect(exec_id).get("ExitCode")
+
+        return ExecOutput(
+            exit_code=exit_code,
+            stdout_bytes=b"".join(chunks["stdout"]),
+            stderr_bytes=b"".join(chunks["stderr"]),
+            duration_ms=int((time.time() - start_time) * 1000),
+            output_limit_exceeded=limit_exceeded
+        )
+
+    def write_data_files(self, files: Dict[str, bytes]):
+        """
+        Write files under DATA_DIR that the submission can read but not change.
+
+        They are written as root and made read-only, so the submission's user
+        can neither modify them nor add files next to them. Contents are
+        streamed over the exec's stdin, since they can be far larger than a
+        command line. Raises RuntimeError if a file can't be written.
+        """
+        for path, data in files.items():
+            target = f"{self.DATA_DIR}/{path}"
+            # head stops after exactly the file's bytes, so the write doesn't wait for EOF on stdin
+            command = f"sh -c 'mkdir -p \"$(dirname {target})\" && head -c {len(data)} > {target} && chmod 444 {target}'"
+            self._exec_with_input(command, data, user="root")
+
+    def write_executable(self, path: str, data: bytes):
+        """
+        Write an executable under WORKDIR, e.g. an uploaded binary in place of a build's output.
+
+        It's owned by the submission's user, like anything it would have
+        built, and streamed over stdin since it can be far larger than a
+        command line. Raises RuntimeError if it can't be written.
+        """
+        target = f"{self.WORKDIR}/{path}"
+        self._exec_with_input(f"sh -c 'head -c {len(data)} > {target} && chmod 755 {target}'", data, user=self.USER)
+
+    def snapshot_workdir(self):
+        """
+        Save WORKDIR as it is now, e.g. right after a build, for restore_workdir().
+
+        The snapshot is written as root and readable only by root, so nothing
+        the submission runs can change what later runs start from.
+        """
+        self._exec_as_root(
+            f"sh -c 'rm -f {WORKDIR_SNAPSHOT} && tar -C {self.WORKDIR} -cf {WORKDIR_SNAPSHOT} . "
+            f"&& chmod 600 {WORKDIR_SNAPSHOT}'"
+        )
+
+    def restore_workdir(self):
+        """
+        Put WORKDIR back to the last snapshot between runs of the same build.
+
+        Processes the previous run left behind are killed first, then WORKDIR,
+        /tmp and /dev/shm are cleared, so a run can't pass anything on to the
+        next.
+        Raises RuntimeError if the workdir can't be restored.
+        """
+        # kill -1 skips the calling shell, and the idle init process ignores signals from inside
+        self._exec_as_root(
+            f"sh -c 'kill -KILL -1 2>/dev/null; find {self.WORKDIR} /tmp /dev/shm -mindepth 1 -delete "
+            f"&& tar -C {self.WORKDIR} -xpf {WORKDIR_SNAPSHOT}'"
+        )
+
+    def discard_snapshot(self):
+        """Remove the workdir snapshot once no more runs need it, since its tmpfs counts against the memory limit."""
+        self._exec_as_root(f"rm -f {WORKDIR_SNAPSHOT}")
+
+    def _exec_as_root(self, command: str):
+        result = self.exec(command, user="root")
+        if result.exit_code != 0:
+            raise RuntimeError(f"Command failed with exit code {result.exit_code}: {result.stderr}")
+
+    def _exec_with_input(self, command: str, data: bytes, user: str):
+        api = self.docker_client.api
+        exec_id = api.exec_create(
+            self.container.id,
+            command,
+            stdin=True,
+            stdout=True,
+            stderr=True,
+            user=user,
+            workdir=self.WORKDIR
+        )["Id"]
+        attached = api.exec_start(exec_id, socket=True)
+        # docker-py hands back a SocketIO wrapper; writes need the socket underneath
+        sock = getattr(attached, "_sock", attached)
+        try:
+            sock.sendall(data)
+            stderr = b"".join(chunk for stream, chunk in read_frames(sock) if stream == STDERR_FRAME)
+        finally:
+            sock.close()
+        exit_code = api.exec_inspect(exec_id).get("ExitCode")
+        if exit_code != 0:
+            raise RuntimeError(f"Command failed with exit code {exit_code}: {stderr.decode('utf-8', errors='replace')}")
+
+    def partial_output(self) -> ExecOutput:
+        """What the current exec has written so far, for one that is being abandoned."""
+        # Copies, since the reading thread may still be appending
+        return ExecOutput(
+            exit_code=None,
+            stdout_bytes=b"".join(list(self._chunks["stdout"])),
+            stderr_bytes=b"".join(list(self._chunks["stderr"])),
+            duration_ms=int((time.time() - self._exec_started) * 1000),
+            timed_out=True
+        )
+
+    def memory_usage(self) -> MemoryUsage:
+        """
+        Peak memory and OOM kills recorded for the container.
+
+        OOM kills are counted since the last record_memory_baseline() call and
+        the peak since the last reset_memory_peak() call; a peak that never
+        passed the one recorded then is reported as 0, with below_baseline
+        set. Docker's OOMKilled flag is also checked, in case the cgroup
+        counter can't be read; it never clears, so once set before the
+        baseline only the counter is trusted.
+        """
+        usage = self._probe_memory()
+        if self._peak_baseline and usage.peak_bytes <= self._peak_baseline:
+            usage.peak_bytes = 0
+            usage.below_baseline = True
+        usage.oom_kills = max(usage.oom_kills - self._oom_kill_baseline, 0)
+        usage.state_oom_killed = self._state_oom_killed() and not self._state_oom_killed_baseline
+        return usage
+
+    def record_memory_baseline(self):
+        """Start counting OOM kills from now, e.g. when a pooled container is reused."""
+        self._oom_kill_baseline = self._probe_memory().oom_kills
+        self._state_oom_killed_baseline = self._state_oom_killed()
+
+    def reset_memory_peak(self) -> bool:
+        """
+        Measure peak memory from now on, e.g. so a run isn't charged for its build.
+
+        The cgroup's high-water mark is cleared where the kernel allows it;
+        otherwise the current peak becomes the baseline memory_usage() has to
+        pass. Returns False if the peak can be neither cleared nor read.
+        """
+        try:
+            if self.exec(MEMORY_PEAK_RESET_COMMAND, user="root").exit_code == 0:
+                self._peak_baseline = 0
+                return True
+        except Exception as e:
+            logger.warning(f"Failed to reset peak memory for container {self.container.id}: {e}")
+            return False
+        self._peak_baseline = self._probe_memory().peak_bytes
+        return self._peak_baseline > 0
+
+    def _state_oom_killed(self) -> bool:
+        try:
+            self.container.reload()
+        except Exception as e:
+            logger.warning(f"Failed to inspect container {self.container.id}: {e}")
+            return False
+        attrs = self.container.attrs
+        return isinstance(attrs, dict) and attrs.get("State", {}).get("OOMKilled") is True
+
+    def _probe_memory(self) -> MemoryUsage:
+        usage = MemoryUsage()
+        try:
+            probe = self.exec(MEMORY_PROBE_COMMAND)
+        except Exception as e:
+            logger.warning(f"Failed to probe memory for container {self.container.id}: {e}")
+            return usage
+        
+        for line in probe.stdout.splitlines():
+            parts = line.split()
+            if len(parts) == 1 and parts[0].isdigit():
+                usage.peak_bytes = int(parts[0])
+            elif len(parts) == 2 and parts[0] == "oom_kill" and parts[1].isdigit():
+                usage.oom_kills = int(parts[1])
+        return usage
+
+    def stats(self) -> dict:
+        try:
+            return self.container.stats(stream=False)
+        except Exception as e:
+            logger.warning(f"Failed to read stats for container {self.container.id}: {e}")
+            return {}
+
+    def terminate(self):
+        """
+        SIGTERM every process run as the submission's user, so they can exit cleanly.
+
+        Like the first half of docker stop, but aimed at exec'd processes
+        rather than the idle init process, which ignores the signal.
+        """
+        try:
+            self.container.exec_run("kill -TERM -1", user=self.USER, detach=True)
+        except Exception as e:
+            logger.warning(f"Failed to signal processes in container {self.container.id}: {e}")
+
+    def kill(self):
+        """Force-stop the container; any exec still streaming output ends."""
+        self.killed = True
+        try:
+            self.container.kill()
+        except Exception as e:
+            logger.warning(f"Failed to kill container {self.container.id}: {e}")
+
+    def remove(self):
+        if self.container is None:
+            return
+        try:
+            self.container.remove(force=True)
+        except Exception as e:
+            logger.warning(f"Failed to remove container {self.container.id}: {e}")
+
+    def __enter__(self):
+        return self.start()
+
+    def __exit__(self, exc_type, exc, tb):
+        self.remove()
+
+
+class CombinedOutput:
+    """
+    Collects stdout and stderr into one text in the order chunks arrived.
+
+    Use write as an exec's on_output callback. Docker frames each write
+    separately, so ordering across the two streams is kept at the level of
+    the program's writes (after its own buffering). Each stream is decoded
+    incrementally, so a UTF-8 character split across chunks stays intact.
+    """
+
+    def __init__(self, forward: Optional[Callable[[str, bytes], None]] = None):
+        self.forward = forward
+        self._parts = []
+        self._decoders = {
+            stream: codecs.getincrementaldecoder("utf-8")(errors="replace") for stream in ("stdout", "stderr")
+        }
+
+    def write(self, stream: str, data: bytes):
+        self._parts.append(self._decoders[stream].decode(data))
+        if self.forward:
+            self.forward(stream, data)
+
+    def text(self) -> str:
+        tails = [decoder.decode(b"", final=True) for decoder in self._decoders.values()]
+        return "".join(self._parts + tails)
+
+
+def _decode(data: bytes) -> str:
+    return data.decode("utf-8", errors="replace")
@@ -0,0 +1,301 @@
+import asyncio
+import hashlib
+import json
+import logging
+import uuid
+from collections import OrderedDict
+from contextlib import nullcontext
+from typing import Awaitable, Callable, Dict, List, Optional, Set
+
+from app.core.config import settings
+from app.core.execution_languages import InvalidSubmissionError
+from app.schemas.execution import (
+    BatchResult,
+    BatchSubmission,
+    ExecutionStatus,
+    JobResult,
+    JobStatus,
+    RunRequest,
+    RunResult,
+    TestCase,
+    TestCaseResult
+)
+from app.services.execution import current_job_id, execution_service
+from app.services.execution_callbacks import CallbackSender
+from app.services.execution_metrics import ExecutionMetrics, execution_metrics
+from app.services.execution_results import PostgresResultStore, ResultStore
+from app.services.execution_verdict import summarize
+from app.services.execution_workers import PooledExecutor
+
+logger = logging.getLogger(__name__)
+
+
+class QueueFullError(Exception):
+    """Raised by submit() when max_queue jobs are already waiting to run."""
+
+
+class SchedulerClosedError(Exception):
+    """Raised by submit() and run_batch() once shutdown() has been called."""
+
+
+class Scheduler:
+    """
+    Runs submissions with bounded concurrency.
+
+    At most max_concurrent jobs run at once; up to max_queue more wait their
+    turn, and anything beyond that is rejected instead of piling up containers.
+    Completed results are saved to the store under their job ID, so they can
+    still be fetched after the scheduler has forgotten the job: it keeps only
+    the max_completed most recently completed jobs, evicting the oldest
+    first. Batches run
+    through case_runner and share the same concurrency slots. With workers,
+    each job also needs one of its language's workers first, so one language
+    can't take every slot. Jobs submitted with a callback URL have their
+    result POSTed there through callbacks once they complete. shutdown()
+    drains submitted jobs, and callbacks still being delivered, before a deploy.
+    """
+
+    def __init__(
+        self,
+        runner: Callable[[RunRequest], Awaitable[RunResult]],
+        max_concurrent: int = 4,
+        max_queue: int = 100,
+        store: Optional[ResultStore] = None,
+        case_runner: Optional[Callable[[RunRequest, List[TestCase]], Awaitable[List[TestCaseResult]]]] = None,
+        metrics: Optional[ExecutionMetrics] = None,
+        workers: Optional[PooledExecutor] = None,
+        callbacks: Optional[CallbackSender] = None,
+        max_completed: int = 1000
+    ):
+        self.runner = runner
+        self.workers = workers
+        self.callbacks = callbacks
+        self.metrics = metrics or execution_metrics
+        self.store = store
+        self.case_runner = case_runner
+        self.max_concurrent = max_concurrent
+        self.max_queue = max_queue
+        self.max_completed = max_completed
+        self._slots = asyncio.Semaphore(max_concurrent)
+        self._jobs: Dict[str, JobResult] = {}
+        # Who submitted each job in _jobs; only they can read it back
+        self._owners: Dict[str, Optional[int]] = {}
+        self._tasks: Dict[str, asyncio.Task] = {}
+        # IDs of completed jobs still held in _jobs, oldest first
+        self._completed: "OrderedDict[str, None]" = OrderedDict()
+        self._deliveries: Set[asyncio.Task] = set()
+        self._queued = 0
+        self._closed = False
+
+    @property
+    def queued(self) -> int:
+        """Jobs submitted but not yet running."""
+        return self._queued
+
+    def submit(self, request: RunRequest, callback_url: Optional[str] = None, user_id: Optional[int] = None) -> str:
+        """
+        Queue a submission and return its job ID without waiting for it to run.
+        
+        With a callback_url the result is also POSTed there when the job
+        completes; raises ValueError if the scheduler has no CallbackSender.
+        user_id records who submitted the job, for result() and the store.
+        """
+        if callback_url and self.callbacks is None:
+            raise ValueError("Job callbacks are not configured")
+        if self._closed:
+            self.metrics.queue_rejections.labels(reason="shutting_down").inc()
+            raise SchedulerClosedError("Executor is shutting down")
+        if self._queued >= self.max_queue:
+            self.metrics.queue_rejections.labels(reason="queue_full").inc()
+            raise QueueFullError(f"Execution queue is full ({self.max_queue} jobs waiting)")
+
+        job_id = str(uuid.uuid4())
+        self._jobs[job_id] = JobResult(job_id=job_id, status=JobStatus.PENDING)
+        self._owners[job_id] = user_id
+        self._queued += 1
+        self._tasks[job_id] = asyncio.create_task(self._run(job_id, request, callback_url))
+        return job_id
+
+    async def result(self, job_id: str, wait: bool = False, user_id: Optional[int] = None) -> JobResult:
+        """
+        Current state of a job, optionally waiting for it to complete. Raises KeyError if unknown.
+        
+        With user_id, a job someone else submitted raises KeyError too.
+        """
+        if user_id is not None and job_id in self._owners and self._owners[job_id] != user_id:
+            raise KeyError(job_id)
+        task = self._tasks.get(job_id)
+        if wait and task is not None:
+            await asyncio.shield(task)
+        # Evicted jobs, possibly while this waited, are only in the store
+        job = self._jobs.get(job_id)
+        if job is not None:
+            return job
+        stored = await asyncio.to_thread(self.store.get, job_id, user_id) if self.store else None
+        if stored is None:
+            raise KeyError(job_id)
+        return JobResult(job_id=job_id, status=JobStatus.COMPLETED, result=stored.result)
+
+    async def run_batch(self, submissions: List[BatchSubmission], test_cases: List[TestCase]) -> BatchResult:
+        """
+        Run every submission against the test cases, keyed by submission ID.
+        
+        Submissions with identical source and run settings are executed once
+        and share the results. Batch runs take concurrency slots like jobs but
+        aren't counted against max_queue.
+        """
+        if self._closed:
+            raise SchedulerClosedError("Executor is shutting down")
+        groups: Dict[str, List[BatchSubmission]] = {}
+        for submission in submissions:
+            groups.setdefault(self._submission_hash(submission), []).append(submission)
+        
+        async def run_group(group: List[BatchSubmission]) -> List[TestCaseResult]:
+            async with self._worker(group[0].language), self._slots:
+                # Containers are labelled with the first submission sharing this source
+                current_job_id.set(group[0].submission_id)
+                try:
+                    return await self.case_runner(group[0], test_cases)
+                except InvalidSubmissionError as e:
+                    return self._failed_cases(test_cases, ExecutionStatus.INVALID_SUBMISSION, str(e))
+                except Exception as e:
+                    logger.error(f"Batch submission {group[0].submission_id} failed: {e}")
+                    return self._failed_cases(test_cases, ExecutionStatus.INTERNAL_ERROR, f"Internal error: {str(e)}")
+        
+        outcomes = await asyncio.gather(*(run_group(group) for group in groups.values()))
+        
+        batch = BatchResult(executions=len(groups), cache_hits=len(submissions) - len(groups))
+        for group, results in zip(groups.values(), outcomes):
+            verdict = summarize(results)
+            for submission in group:
+                batch.results[submission.submission_id] = list(results)
+                batch.verdicts[submission.submission_id] = verdict
+        return batch
+    
+    @staticmethod
+    def _failed_cases(test_cases: List[TestCase], status: ExecutionStatus, error_message: str) -> List[TestCaseResult]:
+        return [
+            TestCaseResult(
+                input=test_case.input,
+                expected_output=test_case.expected_output,
+                actual_output="",
+                status=status,
+                execution_time_ms=0,
+                memory_used_mb=0,
+                passed=False,
+                error_message=error_message
+            )
+            for test_case in test_cases
+        ]
+    
+    @staticmethod
+    def _submission_hash(submission: BatchSubmission) -> str:
+        # Everything that affects the outcome except the ID; stdin is replaced by each case's input
+        fields = submission.model_dump(mode="json", exclude={"submission_id", "stdin", "cacheable"})
+        return hashlib.sha256(json.dumps(fields, sort_keys=True).encode()).hexdigest()
+    
+    async def shutdown(self, timeout: float):
+        """
+        Stop accepting jobs and let the ones already submitted finish.
+        
+        submit() and run_batch() raise SchedulerClosedError from the moment
+        this is called. Queued and running jobs get up to timeout seconds to
+        complete and save their results; any still unfinished are then
+        cancelled, which removes their sandboxes, and recorded as internal
+        errors so pollers don't wait on them forever.
+        """
+        self._closed = True
+        deadline = asyncio.get_running_loop().time() + timeout
+        tasks = list(self._tasks.values())
+        if tasks:
+            logger.info(f"Draining {len(tasks)} execution jobs before shutdown")
+            _, pending = await asyncio.wait(tasks, timeout=timeout)
+            if pending:
+                logger.warning(f"Cancelling {len(pending)} execution jobs still running after {timeout}s")
+                for task in pending:
+                    task.cancel()
+                await asyncio.gather(*pending, return_exceptions=True)
+        if self._deliveries:
+            # Jobs that finished in time still report back, within what's left of the timeout
+            remaining = max(deadline - asyncio.get_running_loop().time(), 0)
+            _, undelivered = await asyncio.wait(set(self._deliveries), timeout=remaining)
+            for task in undelivered:
+                task.cancel()
+    
+    async def _run(self, job_id: str, request: RunRequest, callback_url: Optional[str] = None):
+        started = False
+        try:
+            async with self._worker(request.language), self._slots:
+                self._queued -= 1
+                started = True
+                self._jobs[job_id] = JobResult(job_id=job_id, status=JobStatus.RUNNING)
+                # Each job runs in its own task, so this only labels this job's containers
+                current_job_id.set(job_id)
+                try:
+                    result = await self.runner(request)
+                except Exception as e:
+                    logger.error(f"Job {job_id} failed: {e}")
+                    result = RunResult(
+                        status=ExecutionStatus.INTERNAL_ERROR,
+                        error_message=f"Internal error: {str(e)}"
+                    )
+            await self._save(job_id, request, result)
+            self._complete(job_id, result)
+            if callback_url:
+                self._deliver(job_id, callback_url, result)
+        except asyncio.CancelledError:
+            result = RunResult(
+                status=ExecutionStatus.INTERNAL_ERROR,
+                error_message="Execution cancelled: executor shutting down"
+            )
+            await self._save(job_id, request, result)
+            self._complete(job_id, result)
+            raise
+        finally:
+            if not started:
+                # Cancelled while still waiting for a slot
+                self._queued -= 1
+            self._tasks.pop(job_id, None)
+
+    def _complete(self, job_id: str, result: RunResult):
+        self._jobs[job_id] = JobResult(job_id=job_id, status=JobStatus.COMPLETED, result=result)
+        self._completed[job_id] = None
+        while len(self._completed) > self.max_completed:
+            evicted, _ = self._completed.popitem(last=False)
+            del self._jobs[evicted]
+            del self._owners[evicted]
+
+    def _deliver(self, job_id: str, callback_url: str, result: RunResult):
+        # Separate from the job's task, so waiting on the result doesn't wait on the receiver
+        delivery = asyncio.create_task(self.callbacks.send(callback_url, job_id, result))
+        self._deliveries.add(delivery)
+        delivery.add_done_callback(self._deliveries.discard)
+
+    def _worker(self, language: str):
+        return self.workers.worker(language) if self.workers is not None else nullcontext()
+
+    async def _save(self, job_id: str, request: RunRequest, result: RunResult):
+        if self.store is None:
+            return
+        try:
+            await asyncio.to_thread(self.store.save, job_id, result, request.language, self._owners.get(job_id))
+        except Exception as e:
+            # The caller still gets the result; only history is lost
+            logger.error(f"Failed to store result for job {job_id}: {e}")
+
+
+# Global instance
+execution_scheduler = Scheduler(
+    execution_service.run_code,
+    max_concurrent=settings.execution_max_concurrent,
+    max_queue=settings.execution_max_queue,
+    max_completed=settings.execution_max_completed_jobs,
+    store=PostgresResultStore(),
+    case_runner=execution_service.run_test_cases,
+    workers=PooledExecutor(settings.execution_language_workers),
+    callbacks=CallbackSender(
+        settings.execution_callback_secret,
+        attempts=settings.execution_callback_attempts,
+        allowed_hosts=settings.execution_callback_allowed_hosts
+    ) if settings.execution_callback_secret else None
+)
@@ -0,0 +1,44 @@
+"""
+Decoding the signal behind a program's exit status.
+
+The shell running a submission reports a program killed by a signal as
+128 plus the signal number, as do timeout and docker exec after it, so a
+segfault reaches the executor as exit code 139. These turn that back into
+the signal's name and a reason a submitter can act on.
+"""
+
+import signal
+from typing import Optional
+
+# Shells add this to the number of the signal that killed a command
+SIGNAL_EXIT_OFFSET = 128
+
+# What each signal usually means for a submission; others are reported by name alone
+SIGNAL_REASONS = {
+    signal.SIGSEGV: "Segmentation fault: the program accessed memory it doesn't own, e.g. a null pointer",
+    signal.SIGABRT: "Aborted: the program called abort(), e.g. from a failed assertion or uncaught exception",
+    signal.SIGFPE: "Arithmetic error, e.g. integer division by zero",
+    signal.SIGBUS: "Bus error: the program accessed misaligned or unmapped memory",
+    signal.SIGILL: "Illegal instruction, e.g. from undefined behaviour or a corrupted stack",
+    signal.SIGKILL: "Killed",
+    signal.SIGTERM: "Terminated",
+    signal.SIGPIPE: "Broken pipe: the program wrote to a closed pipe",
+    signal.SIGXCPU: "CPU time limit exceeded",
+    signal.SIGXFSZ: "File size limit exceeded",
+}
+
+
+def exit_signal(exit_code: Optional[int]) -> Optional[signal.Signals]:
+    """The signal an exit code says the program was killed by; None for normal exits."""
+    if exit_code is None or exit_code <= SIGNAL_EXIT_OFFSET:
+        return None
+    try:
+        return signal.Signals(exit_code - SIGNAL_EXIT_OFFSET)
+    except ValueError:
+        return None
+
+
+def signal_reason(sig: signal.Signals) -> str:
+    """Human-readable reason for a program killed by the signal, ending with its name."""
+    reason = SIGNAL_REASONS.get(sig, "Killed by a signal")
+    return f"{reason} ({sig.name})"
@@ -35,7 +35,7 @@ class CodeExecutionService:
             },
             Language.JAVASCRIPT: {
                 "image": "assessment-js-executor",
-                "dockerfile": "backend/docker/execution/Dockerfile.javascript",
+                "dockerfile": "backend/docker/execution/Dockerfile.node",
                 "file_extension": ".js",
                 "compile_command": None,
                 "run_command": "node {filename}",
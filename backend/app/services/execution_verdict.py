@@ -0,0 +1,71 @@
+from typing import List
+
+from app.schemas.execution import ExecutionStatus, RunResult, TestCaseResult, Verdict, VerdictStatus
+
+# When cases fail differently, the overall verdict is the earliest of these that occurred
+VERDICT_PRIORITY = (
+    VerdictStatus.COMPILE_ERROR,
+    VerdictStatus.INTERNAL_ERROR,
+    VerdictStatus.RUNTIME_ERROR,
+    VerdictStatus.MEMORY_LIMIT_EXCEEDED,
+    VerdictStatus.TIME_LIMIT_EXCEEDED,
+    VerdictStatus.OUTPUT_LIMIT_EXCEEDED,
+    VerdictStatus.WRONG_ANSWER,
+)
+
+_STATUS_VERDICTS = {
+    ExecutionStatus.SUCCESS: VerdictStatus.WRONG_ANSWER,
+    ExecutionStatus.COMPILATION_ERROR: VerdictStatus.COMPILE_ERROR,
+    ExecutionStatus.TIMEOUT: VerdictStatus.TIME_LIMIT_EXCEEDED,
+    ExecutionStatus.MEMORY_LIMIT_EXCEEDED: VerdictStatus.MEMORY_LIMIT_EXCEEDED,
+    ExecutionStatus.OUTPUT_LIMIT_EXCEEDED: VerdictStatus.OUTPUT_LIMIT_EXCEEDED,
+    ExecutionStatus.SECURITY_VIOLATION: VerdictStatus.RUNTIME_ERROR,
+    # Like a compile error, the submission itself is at fault and nothing ran
+    ExecutionStatus.INVALID_SUBMISSION: VerdictStatus.COMPILE_ERROR,
+    ExecutionStatus.INTERNAL_ERROR: VerdictStatus.INTERNAL_ERROR,
+}
+
+
+def summarize(results: List[TestCaseResult]) -> Verdict:
+    """
+    Reduce a submission's test case results to one verdict.
+
+    All cases passing is accepted. Otherwise the status is the highest
+    priority failure in VERDICT_PRIORITY (a compile error beats everything,
+    then runtime errors, limits and finally wrong answers), and
+    first_failure points at the first case that failed, whatever its kind.
+    """
+    failures = [(index, case_verdict(result)) for index, result in enumerate(results) if not result.passed]
+    passed = len(results) - len(failures)
+    if not failures:
+        return Verdict(status=VerdictStatus.ACCEPTED, passed=passed, total=len(results))
+
+    statuses = {status for _, status in failures}
+    return Verdict(
+        status=next(status for status in VERDICT_PRIORITY if status in statuses),
+        passed=passed,
+        total=len(results),
+        first_failure=failures[0][0]
+    )
+
+
+def case_verdict(result: TestCaseResult) -> VerdictStatus:
+    """What a single test case result means for the submission."""
+    if result.passed:
+        return VerdictStatus.ACCEPTED
+    # Output mismatches are reported with RUNTIME_ERROR status but come from a clean run
+    if result.diff is not None or (result.run is not None and result.run.status == ExecutionStatus.SUCCESS):
+        return VerdictStatus.WRONG_ANSWER
+    return _STATUS_VERDICTS.get(result.status, VerdictStatus.RUNTIME_ERROR)
+
+
+def run_verdict(result: RunResult) -> Verdict:
+    """Verdict for a single run with no expected output: accepted if the program ran cleanly."""
+    if result.status == ExecutionStatus.SUCCESS:
+        return Verdict(status=VerdictStatus.ACCEPTED, passed=1, total=1)
+    return Verdict(
+        status=_STATUS_VERDICTS.get(result.status, VerdictStatus.RUNTIME_ERROR),
+        passed=0,
+        total=1,
+        first_failure=0
+    )
@@ -0,0 +1,58 @@
+import asyncio
+from contextlib import asynccontextmanager
+from typing import AsyncIterator, Awaitable, Callable, Dict, Optional
+
+from app.schemas.execution import RunRequest, RunResult
+from app.services.execution import execution_service
+
+
+class PooledExecutor:
+    """
+    Runs submissions with a separate concurrency limit per language.
+
+    Each language in max_workers gets its own pool of that many workers, and
+    its submissions queue there in arrival order, so a backlog of slow C++
+    compiles can't hold up Python runs. Languages that aren't listed have no
+    limit of their own. The scheduler takes a language's worker before one of
+    its shared slots, so submissions waiting here never hold a shared slot.
+    """
+
+    def __init__(
+        self,
+        max_workers: Dict[str, int],
+        runner: Optional[Callable[[RunRequest], Awaitable[RunResult]]] = None
+    ):
+        for language, workers in max_workers.items():
+            if workers < 1:
+                raise ValueError(f"Language {language} needs at least one worker, got {workers}")
+        self.runner = runner or execution_service.run_code
+        self.max_workers = dict(max_workers)
+        self._pools = {language: asyncio.Semaphore(workers) for language, workers in max_workers.items()}
+        self._waiting: Dict[str, int] = {language: 0 for language in max_workers}
+
+    def waiting(self, language: str) -> int:
+        """Submissions queued for one of the language's workers."""
+        return self._waiting.get(getattr(language, "value", language), 0)
+
+    @asynccontextmanager
+    async def worker(self, language: str) -> AsyncIterator[None]:
+        """Hold one of the language's workers, waiting for one to be free."""
+        language = getattr(language, "value", language)
+        pool = self._pools.get(language)
+        if pool is None:
+            yield
+            return
+        self._waiting[language] += 1
+        try:
+            await pool.acquire()
+        finally:
+            self._waiting[language] -= 1
+        try:
+            yield
+        finally:
+            pool.release()
+
+    async def run(self, request: RunRequest) -> RunResult:
+        """Run a submission once one of its language's workers is free."""
+        async with self.worker(request.language):
+            return await self.runner(request)
@@ -1,9 +1,8 @@
 # C++ execution container with enhanced security
-FROM gcc:11-slim
+FROM gcc:13
 
-# Install security tools
+# Install security tools (coreutils provides timeout)
 RUN apt-get update && apt-get install -y \
-    timeout \
     coreutils \
     && rm -rf /var/lib/apt/lists/* \
     && apt-get clean
@@ -1,9 +1,10 @@
 # Go execution container with enhanced security
-FROM golang:1.21-slim
+# Build other toolchains with --build-arg GO_VERSION=1.22
+ARG GO_VERSION=1.21
+FROM golang:${GO_VERSION}-bookworm
 
-# Install security tools
+# Install security tools (coreutils provides timeout)
 RUN apt-get update && apt-get install -y \
-    timeout \
     coreutils \
     && rm -rf /var/lib/apt/lists/* \
     && apt-get clean
@@ -33,9 +34,13 @@ USER coderunner
 WORKDIR /app/code
 
 # Set environment variables for security
+# Builds with -race turn cgo back on for themselves; the image's gcc is used then
 ENV CGO_ENABLED=0
 ENV GOPROXY=direct
 ENV GOSUMDB=off
+# The root filesystem is read-only at run time; keep build caches on the /tmp tmpfs
+ENV GOCACHE=/tmp/go-cache
+ENV GOPATH=/tmp/go
 
 # Default command
 CMD ["go"]
\ No newline at end of file
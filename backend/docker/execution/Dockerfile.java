@@ -1,9 +1,8 @@
 # Java execution container with enhanced security
 FROM openjdk:17-slim
 
-# Install security tools
+# Install security tools (coreutils provides timeout)
 RUN apt-get update && apt-get install -y \
-    timeout \
     coreutils \
     && rm -rf /var/lib/apt/lists/* \
     && apt-get clean
@@ -28,20 +27,12 @@ RUN mkdir -p /app/code \
 # Remove potentially dangerous binaries
 RUN rm -f /usr/bin/wget /usr/bin/curl /usr/bin/nc /usr/bin/netcat
 
-# Create Java security policy file
-RUN echo 'grant {\n\
-    permission java.io.FilePermission "/app/code/-", "read,write,delete";\n\
-    permission java.io.FilePermission "/tmp/-", "read,write,delete";\n\
-    permission java.lang.RuntimePermission "exitVM";\n\
-    permission java.util.PropertyPermission "*", "read";\n\
-};' > /app/code/security.policy
-
 # Switch to non-root user
 USER coderunner
 WORKDIR /app/code
 
-# Set environment variables for security
-ENV JAVA_OPTS="-Xmx128m -Xms32m -XX:MaxMetaspaceSize=64m -Djava.security.manager -Djava.security.policy=/app/code/security.policy"
+# JVM flags live in the language registry's run command (JAVA_OPTS is never
+# read by java); the default heap follows the container memory limit
 
 # Default command
-CMD ["java"]
\ No newline at end of file
+CMD ["java"]
@@ -0,0 +1,47 @@
+# PHP execution container with enhanced security
+FROM php:8.2-cli
+
+# Install security tools (coreutils provides timeout)
+RUN apt-get update && apt-get install -y \
+    coreutils \
+    && rm -rf /var/lib/apt/lists/* \
+    && apt-get clean
+
+# Create non-root user for security with restricted permissions
+RUN useradd -m -u 1000 -s /bin/bash coderunner \
+    && usermod -L coderunner
+
+# Set strict resource limits
+RUN echo "coderunner soft nproc 16" >> /etc/security/limits.conf \
+    && echo "coderunner hard nproc 16" >> /etc/security/limits.conf \
+    && echo "coderunner soft nofile 32" >> /etc/security/limits.conf \
+    && echo "coderunner hard nofile 32" >> /etc/security/limits.conf \
+    && echo "coderunner soft fsize 10485760" >> /etc/security/limits.conf \
+    && echo "coderunner hard fsize 10485760" >> /etc/security/limits.conf
+
+# Create execution directory with proper permissions
+RUN mkdir -p /app/code \
+    && chown coderunner:coderunner /app/code \
+    && chmod 755 /app/code
+
+# Remove potentially dangerous binaries
+RUN rm -f /usr/bin/wget /usr/bin/curl /usr/bin/nc /usr/bin/netcat
+
+# Errors go to stderr rather than being mixed into stdout; process control,
+# sockets and remote includes are disabled
+RUN { \
+        echo "display_errors = stderr"; \
+        echo "log_errors = Off"; \
+        echo "html_errors = Off"; \
+        echo "allow_url_fopen = Off"; \
+        echo "allow_url_include = Off"; \
+        echo "disable_functions = exec,shell_exec,system,passthru,proc_open,popen,pcntl_exec,pcntl_fork,fsockopen,pfsockopen,stream_socket_client,stream_socket_server,dl"; \
+        echo "expose_php = Off"; \
+    } > /usr/local/etc/php/conf.d/zz-sandbox.ini
+
+# Switch to non-root user
+USER coderunner
+WORKDIR /app/code
+
+# Default command
+CMD ["php"]
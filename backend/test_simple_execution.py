@@ -13,10 +13,10 @@ def test_get_supported_languages():
     """Test getting supported languages."""
     service = CodeExecutionService()
     languages = service.get_supported_languages()
-    assert len(languages) == 7
+    assert len(languages) == 9
     
     language_names = [lang.name for lang in languages]
-    expected_names = ["python", "javascript", "java", "cpp", "csharp", "go", "rust"]
+    expected_names = ["python", "javascript", "java", "cpp", "csharp", "go", "rust", "php", "typescript"]
     for name in expected_names:
         assert name in language_names
 
@@ -0,0 +1,408 @@
+import pytest
+from unittest.mock import AsyncMock, patch
+from fastapi.testclient import TestClient
+from app.main import app
+from app.core.database import get_db
+from app.schemas.execution import ExecutionStatus, JobResult, JobStatus, LanguageLimits, RunResult
+from app.services.execution import ExecutionUnavailableError, execution_service
+from app.services.execution_callbacks import CallbackSender
+from app.services.execution_idempotency import IdempotencyKeys
+from app.services.execution_results import InMemoryResultStore
+from app.services.execution_scheduler import execution_scheduler
+from tests.conftest import override_get_db
+
+
+# Override the database dependency
+app.dependency_overrides[get_db] = override_get_db
+
+client = TestClient(app)
+
+
+def test_run_code_returns_result(db, test_user, auth_headers):
+    """Test running code returns the structured run result"""
+    run_result = RunResult(status=ExecutionStatus.SUCCESS, stdout="hi\n", exit_code=0, duration_ms=12)
+
+    with patch.object(execution_scheduler, "runner", new=AsyncMock(return_value=run_result)) as run_code:
+        response = client.post(
+            "/api/v1/execution/run",
+            json={"code": "print('hi')", "language": "python", "stdin": "", "timeout_ms": 2000},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 200
+    data = response.json()
+    assert data["status"] == "success"
+    assert data["stdout"] == "hi\n"
+    assert data["timed_out"] is False
+    assert run_code.call_args[0][0].timeout_ms == 2000
+
+
+def test_run_code_timeout_is_not_an_error(db, test_user, auth_headers):
+    """Test a timed-out run still returns 200 with timed_out set"""
+    run_result = RunResult(status=ExecutionStatus.TIMEOUT, timed_out=True, error_message="Execution timeout")
+
+    with patch.object(execution_scheduler, "runner", new=AsyncMock(return_value=run_result)):
+        response = client.post(
+            "/api/v1/execution/run",
+            json={"code": "while True: pass", "language": "python", "timeout_ms": 1000},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 200
+    assert response.json()["timed_out"] is True
+
+
+def test_run_code_queue_full(db, test_user, auth_headers):
+    """Test a full queue is reported as 503 instead of blocking"""
+    with patch.object(execution_scheduler, "max_queue", 0):
+        response = client.post(
+            "/api/v1/execution/run",
+            json={"code": "print('hi')", "language": "python"},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 503
+
+
+def test_get_job_after_scheduler_forgets_it(db, test_user, auth_headers):
+    """Test a finished job is still served from the result store, e.g. after a restart"""
+    run_result = RunResult(status=ExecutionStatus.SUCCESS, stdout="hi\n", exit_code=0)
+    store = InMemoryResultStore()
+    store.save("job-1", run_result, "python", test_user.id)
+
+    with patch.object(execution_scheduler, "store", store):
+        response = client.get("/api/v1/execution/jobs/job-1", headers=auth_headers)
+
+    assert response.status_code == 200
+    data = response.json()
+    assert data["status"] == "completed"
+    assert data["result"]["stdout"] == "hi\n"
+
+
+def test_stored_job_of_another_user_is_not_found(db, test_user, instructor_user, instructor_auth_headers):
+    """Test a stored result is only served to the user who submitted it"""
+    store = InMemoryResultStore()
+    store.save("job-1", RunResult(status=ExecutionStatus.SUCCESS, stdout="secret\n"), "python", test_user.id)
+
+    with patch.object(execution_scheduler, "store", store):
+        response = client.get("/api/v1/execution/jobs/job-1", headers=instructor_auth_headers)
+
+    assert response.status_code == 404
+
+
+def test_get_job_of_another_user_is_not_found(db, test_user, auth_headers, instructor_user, instructor_auth_headers):
+    """Test a job can only be read back by the user who submitted it"""
+    run_result = RunResult(status=ExecutionStatus.SUCCESS, stdout="secret\n", exit_code=0)
+
+    with patch.object(execution_scheduler, "runner", new=AsyncMock(return_value=run_result)), \
+            patch.object(execution_scheduler, "store", InMemoryResultStore()):
+        job_id = client.post(
+            "/api/v1/execution/jobs",
+            json={"code": "print('secret')", "language": "python"},
+            headers=auth_headers
+        ).json()["job_id"]
+        other = client.get(f"/api/v1/execution/jobs/{job_id}", headers=instructor_auth_headers)
+        owner = client.get(f"/api/v1/execution/jobs/{job_id}", headers=auth_headers)
+
+    assert other.status_code == 404
+    assert other.json()["detail"] == "Job not found"
+    assert owner.status_code == 200
+    assert owner.json()["job_id"] == job_id
+
+
+def test_get_unknown_job(db, test_user, auth_headers):
+    """Test looking up a job that doesn't exist"""
+    with patch.object(execution_scheduler, "store", InMemoryResultStore()):
+        response = client.get("/api/v1/execution/jobs/missing", headers=auth_headers)
+
+    assert response.status_code == 404
+
+
+def test_run_code_unsupported_language(db, test_user, auth_headers):
+    """Test an unregistered language is rejected with 400"""
+    response = client.post(
+        "/api/v1/execution/run",
+        json={"code": "puts 1", "language": "cobol"},
+        headers=auth_headers
+    )
+
+    assert response.status_code == 400
+    assert response.json()["detail"] == "Unsupported language: cobol"
+
+
+def test_run_code_filename_extension_mismatch(db, test_user, auth_headers):
+    """Test a filename without the language's extension is rejected with 400"""
+    response = client.post(
+        "/api/v1/execution/run",
+        json={"code": "package main", "language": "go", "filename": "main.py"},
+        headers=auth_headers
+    )
+
+    assert response.status_code == 400
+    assert response.json()["detail"] == "Filename 'main.py' must have the .go extension"
+
+
+def test_submit_job_blank_code_rejected(db, test_user, auth_headers):
+    """Test whitespace-only code is rejected with 422 before it is queued"""
+    with patch.object(execution_scheduler, "submit") as submit:
+        response = client.post(
+            "/api/v1/execution/jobs",
+            json={"code": "  \n", "language": "python"},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 422
+    assert response.json()["detail"] == "Source code is empty"
+    submit.assert_not_called()
+
+
+def test_run_code_whitespace_code_rejected(db, test_user, auth_headers):
+    """Test whitespace-only code is rejected with 422 before it is run"""
+    with patch.object(execution_scheduler, "submit") as submit:
+        response = client.post(
+            "/api/v1/execution/run",
+            json={"code": "\t \n", "language": "python"},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 422
+    assert response.json()["detail"] == "Source code is empty"
+    submit.assert_not_called()
+
+
+def test_run_binary_rejected_when_uploads_disabled(db, test_user, auth_headers):
+    """Test a binary is rejected with 400 unless binary uploads are enabled"""
+    with patch.object(execution_service, "allow_binary_upload", False), \
+            patch.object(execution_scheduler, "submit") as submit:
+        response = client.post(
+            "/api/v1/execution/run",
+            json={"binary": "f0VMRgIBAQ==", "binary_arch": "x86_64", "language": "cpp"},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 400
+    assert response.json()["detail"] == "Binary uploads are not enabled on this server"
+    submit.assert_not_called()
+
+
+def test_run_code_repeated_idempotency_key_runs_once(db, test_user, auth_headers):
+    """Test a retried run with the same Idempotency-Key returns the first result without running again"""
+    run_result = RunResult(status=ExecutionStatus.SUCCESS, stdout="hi\n", exit_code=0)
+    body = {"code": "print('hi')", "language": "python"}
+
+    with patch("app.api.execution.idempotency_keys", IdempotencyKeys()), \
+            patch.object(execution_scheduler, "runner", new=AsyncMock(return_value=run_result)) as run_code:
+        first = client.post("/api/v1/execution/run", json=body, headers={**auth_headers, "Idempotency-Key": "a"})
+        retry = client.post("/api/v1/execution/run", json=body, headers={**auth_headers, "Idempotency-Key": "a"})
+        other = client.post("/api/v1/execution/run", json=body, headers={**auth_headers, "Idempotency-Key": "b"})
+
+    assert first.status_code == retry.status_code == other.status_code == 200
+    assert retry.json() == first.json()
+    assert run_code.call_count == 2
+
+
+def test_run_code_internal_error_is_not_replayed(db, test_user, auth_headers):
+    """Test a retry after an internal error runs again rather than getting the failure back"""
+    failed = RunResult(status=ExecutionStatus.INTERNAL_ERROR, error_message="Docker is not available")
+    succeeded = RunResult(status=ExecutionStatus.SUCCESS, stdout="hi\n", exit_code=0)
+    headers = {**auth_headers, "Idempotency-Key": "a"}
+    body = {"code": "print('hi')", "language": "python"}
+
+    with patch("app.api.execution.idempotency_keys", IdempotencyKeys()), \
+            patch.object(execution_scheduler, "runner", new=AsyncMock(side_effect=[failed, succeeded])) as run_code:
+        first = client.post("/api/v1/execution/run", json=body, headers=headers)
+        retry = client.post("/api/v1/execution/run", json=body, headers=headers)
+
+    assert first.json()["status"] == "internal_error"
+    assert retry.json()["status"] == "success"
+    assert run_code.call_count == 2
+
+
+def test_idempotency_key_reused_for_different_request(db, test_user, auth_headers):
+    """Test a key sent again with a different submission is rejected rather than answered with the wrong result"""
+    run_result = RunResult(status=ExecutionStatus.SUCCESS, stdout="hi\n", exit_code=0)
+    headers = {**auth_headers, "Idempotency-Key": "a"}
+
+    with patch("app.api.execution.idempotency_keys", IdempotencyKeys()), \
+            patch.object(execution_scheduler, "runner", new=AsyncMock(return_value=run_result)) as run_code:
+        client.post("/api/v1/execution/run", json={"code": "print('hi')", "language": "python"}, headers=headers)
+        response = client.post("/api/v1/execution/run", json={"code": "print('bye')", "language": "python"}, headers=headers)
+
+    assert response.status_code == 422
+    assert run_code.call_count == 1
+
+
+def test_submit_job_repeated_idempotency_key_returns_same_job(db, test_user, auth_headers):
+    """Test a retried job submission gets the first submission's job ID"""
+    headers = {**auth_headers, "Idempotency-Key": "job-a"}
+    body = {"code": "print('hi')", "language": "python"}
+
+    with patch("app.api.execution.idempotency_keys", IdempotencyKeys()), \
+            patch.object(execution_scheduler, "submit", return_value="job-1") as submit, \
+            patch.object(execution_scheduler, "result", new=AsyncMock(return_value=JobResult(job_id="job-1", status=JobStatus.PENDING))):
+        first = client.post("/api/v1/execution/jobs", json=body, headers=headers)
+        retry = client.post("/api/v1/execution/jobs", json=body, headers=headers)
+
+    assert first.json()["job_id"] == retry.json()["job_id"] == "job-1"
+    submit.assert_called_once()
+
+
+def test_submit_job_with_callback(db, test_user, auth_headers):
+    """Test a job's callback_url is handed to the scheduler but not run as part of the submission"""
+    with patch.object(execution_scheduler, "callbacks", CallbackSender("s3cret", allowed_hosts=["example.com"])), \
+            patch.object(execution_scheduler, "submit", return_value="job-1") as submit, \
+            patch.object(execution_scheduler, "result", new=AsyncMock(return_value={"job_id": "job-1", "status": "pending"})):
+        response = client.post(
+            "/api/v1/execution/jobs",
+            json={"code": "print(1)", "language": "python", "callback_url": "https://example.com/hooks/run"},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 202
+    request = submit.call_args[0][0]
+    assert not hasattr(request, "callback_url")
+    assert submit.call_args[1]["callback_url"] == "https://example.com/hooks/run"
+
+
+def test_submit_job_callback_to_metadata_address_rejected(db, test_user, auth_headers):
+    """Test a callback_url pointing into the server's own network is a 400 and the job isn't queued"""
+    with patch.object(execution_scheduler, "callbacks", CallbackSender("s3cret")), \
+            patch.object(execution_scheduler, "submit") as submit:
+        response = client.post(
+            "/api/v1/execution/jobs",
+            json={"code": "print(1)", "language": "python", "callback_url": "http://169.254.169.254/latest/meta-data/"},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 400
+    assert "non-public address 169.254.169.254" in response.json()["detail"]
+    submit.assert_not_called()
+
+
+def test_submit_job_callback_disabled(db, test_user, auth_headers):
+    """Test a callback_url is a 400 when the server has no callback secret"""
+    with patch.object(execution_scheduler, "callbacks", None), \
+            patch.object(execution_scheduler, "submit") as submit:
+        response = client.post(
+            "/api/v1/execution/jobs",
+            json={"code": "print(1)", "language": "python", "callback_url": "https://example.com/hooks/run"},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 400
+    submit.assert_not_called()
+
+
+def test_run_code_empty_code(db, test_user, auth_headers):
+    """Test empty code fails validation"""
+    response = client.post(
+        "/api/v1/execution/run",
+        json={"code": "", "language": "python"},
+        headers=auth_headers
+    )
+
+    assert response.status_code == 422
+
+
+def test_run_code_requires_auth(db):
+    """Test running code without authentication"""
+    response = client.post(
+        "/api/v1/execution/run",
+        json={"code": "print('hi')", "language": "python"}
+    )
+
+    assert response.status_code == 403
+
+
+def test_update_language_limits(db, admin_user, admin_auth_headers):
+    """Test an admin can change a language's default limits"""
+    limits = LanguageLimits(memory_limit_bytes=256 * 1024 * 1024, timeout_ms=4000)
+
+    with patch.object(execution_service, "update_language_limits", return_value=limits) as update:
+        response = client.put(
+            "/api/v1/execution/languages/go/limits",
+            json={"memory_limit_bytes": 256 * 1024 * 1024, "timeout_ms": 4000},
+            headers=admin_auth_headers
+        )
+
+    assert response.status_code == 200
+    assert response.json() == {"memory_limit_bytes": 256 * 1024 * 1024, "cpu_quota": None, "timeout_ms": 4000}
+    assert update.call_args[0] == ("go", limits)
+
+
+def test_update_language_limits_requires_admin(db, test_user, auth_headers):
+    """Test other users can't change language limits"""
+    with patch.object(execution_service, "update_language_limits") as update:
+        response = client.put(
+            "/api/v1/execution/languages/go/limits",
+            json={"timeout_ms": 4000},
+            headers=auth_headers
+        )
+
+    assert response.status_code == 403
+    update.assert_not_called()
+
+
+def test_update_limits_unknown_language(db, admin_user, admin_auth_headers):
+    """Test changing limits for an unregistered language is a 404"""
+    response = client.put(
+        "/api/v1/execution/languages/cobol/limits",
+        json={"timeout_ms": 4000},
+        headers=admin_auth_headers
+    )
+
+    assert response.status_code == 404
+    assert response.json()["detail"] == "Unsupported language: cobol"
+
+
+def test_benchmark_language_requires_admin(db, test_user, auth_headers):
+    """Test other users can't run the executor benchmark"""
+    with patch("app.api.execution.benchmark", new_callable=AsyncMock) as run_benchmark:
+        response = client.post("/api/v1/execution/languages/python/benchmark", headers=auth_headers)
+
+    assert response.status_code == 403
+    run_benchmark.assert_not_called()
+
+
+def test_benchmark_unknown_language(db, admin_user, admin_auth_headers):
+    """Test benchmarking an unregistered language is a 404"""
+    response = client.post("/api/v1/execution/languages/cobol/benchmark", headers=admin_auth_headers)
+
+    assert response.status_code == 404
+
+
+def test_benchmark_iterations_capped(db, admin_user, admin_auth_headers):
+    """Test a benchmark can't ask for more iterations than the cap"""
+    response = client.post(
+        "/api/v1/execution/languages/python/benchmark?iterations=1000", headers=admin_auth_headers
+    )
+
+    assert response.status_code == 422
+
+
+def test_healthz_ready(db):
+    """Test the readiness check passes when code can be executed"""
+    with patch.object(execution_service, "healthcheck", return_value=None):
+        response = client.get("/healthz")
+
+    assert response.status_code == 200
+    assert response.json()["status"] == "ready"
+
+
+def test_healthz_unavailable(db):
+    """Test the readiness check reports why execution is unavailable"""
+    error = ExecutionUnavailableError("Docker daemon is not responding: connection refused")
+    with patch.object(execution_service, "healthcheck", side_effect=error):
+        response = client.get("/healthz")
+
+    assert response.status_code == 503
+    assert response.json()["detail"] == "Docker daemon is not responding: connection refused"
+
+
+def test_metrics_exposes_execution_statistics(db):
+    """Test the Prometheus endpoint serves execution metrics without auth"""
+    response = client.get("/metrics")
+
+    assert response.status_code == 200
+    assert response.headers["content-type"].startswith("text/plain")
+    assert "codehub_execution_active_containers" in response.text
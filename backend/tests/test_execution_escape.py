@@ -0,0 +1,196 @@
+"""
+Adversarial submissions that try to break out of, or take down, the sandbox.
+
+Each attack runs through the real executor and must end with its expected
+status while leaving the host as it found it: the run finishes within its
+deadline, its container is removed, and a normal submission still runs
+afterwards. Attacks that probe a restriction report what they were denied
+on stdout, so a regression shows up as the program's own words.
+
+Adding a case is one Attack(...) entry in ATTACKS. Like the other
+integration tests these need Docker and the executor images; attacks whose
+image isn't built are skipped.
+"""
+
+import time
+from dataclasses import dataclass, field
+from typing import Any, Dict, Optional, Tuple
+
+import docker
+import pytest
+
+from app.core.execution_languages import get_language_config
+from app.schemas.execution import ExecutionStatus, Language, RunRequest
+from app.services.execution import EXECUTION_DEADLINE_GRACE_SECONDS, CodeExecutionService
+from app.services.execution_sandbox import EXECUTION_LABEL
+from tests.test_execution_integration import requires_image
+
+# Slack on top of the timeout for container start, build and removal
+HOST_DEADLINE_SLACK_SECONDS = 15
+
+# Image of the canary run after each attack
+CANARY_IMAGE = get_language_config(Language.PYTHON).image
+
+
+@dataclass(frozen=True)
+class Attack:
+    name: str
+    code: str
+    statuses: Tuple[ExecutionStatus, ...]  # any of these counts as contained
+    language: Language = Language.PYTHON
+    stdout: Optional[str] = None  # exact stdout, for attacks that report what they were denied
+    request: Dict[str, Any] = field(default_factory=dict)  # extra RunRequest fields, e.g. limits
+
+    @property
+    def image(self) -> str:
+        return get_language_config(self.language).image
+
+
+# Tries each write and prints "denied" unless it went through
+_WRITE_ATTEMPTS = (
+    "import os\n"
+    "def attempt(action):\n"
+    "    try:\n"
+    "        action()\n"
+    "        print('ok')\n"
+    "    except OSError:\n"
+    "        print('denied')\n"
+)
+
+ATTACKS = [
+    Attack(
+        "python_fork_bomb",
+        "import os\nwhile True:\n    os.fork()\n",
+        (ExecutionStatus.RUNTIME_ERROR, ExecutionStatus.TIMEOUT),
+        request={"timeout_ms": 3000},
+    ),
+    Attack(
+        "cpp_fork_bomb",
+        "#include <unistd.h>\nint main() { while (true) fork(); }\n",
+        (ExecutionStatus.RUNTIME_ERROR, ExecutionStatus.TIMEOUT),
+        language=Language.CPP,
+        request={"timeout_ms": 3000},
+    ),
+    Attack(
+        "outbound_tcp_connection",
+        # socket.py is stripped from the image, but the C module still opens raw sockets
+        "import _socket\n"
+        "s = _socket.socket(_socket.AF_INET, _socket.SOCK_STREAM)\n"
+        "s.settimeout(5)\n"
+        "try:\n"
+        "    s.connect(('1.1.1.1', 80))\n"
+        "    print('connected')\n"
+        "except OSError as e:\n"
+        "    print(e.strerror)\n",
+        (ExecutionStatus.SUCCESS,),
+        stdout="Network is unreachable\n",
+    ),
+    Attack(
+        "dns_lookup",
+        "import _socket\n"
+        "try:\n"
+        "    _socket.getaddrinfo('example.com', 80)\n"
+        "    print('resolved')\n"
+        "except OSError:\n"
+        "    print('unresolved')\n",
+        (ExecutionStatus.SUCCESS,),
+        stdout="unresolved\n",
+    ),
+    Attack(
+        "write_outside_workdir",
+        _WRITE_ATTEMPTS
+        + "for path in ('/etc/passwd', '/etc/evil', '/usr/bin/evil', '/app/evil', '/app/data/evil', '/evil'):\n"
+        "    attempt(lambda: open(path, 'a').close())\n",
+        (ExecutionStatus.SUCCESS,),
+        stdout="denied\n" * 6,
+    ),
+    Attack(
+        "exec_from_tmp",
+        _WRITE_ATTEMPTS
+        + "with open('/tmp/payload', 'w') as f:\n"
+        "    f.write('#!/bin/sh\\necho escaped\\n')\n"
+        "os.chmod('/tmp/payload', 0o755)\n"
+        "attempt(lambda: os.execv('/tmp/payload', ['/tmp/payload']))\n",
+        (ExecutionStatus.SUCCESS,),
+        stdout="denied\n",
+    ),
+    Attack(
+        "become_root",
+        _WRITE_ATTEMPTS + "attempt(lambda: os.setuid(0))\n",
+        (ExecutionStatus.SUCCESS,),
+        stdout="denied\n",
+    ),
+    Attack(
+        "output_bomb",
+        "while True: print('x' * 1024)",
+        (ExecutionStatus.OUTPUT_LIMIT_EXCEEDED,),
+    ),
+    Attack(
+        "stderr_bomb",
+        "import sys\nwhile True: sys.stderr.write('x' * 1024)",
+        (ExecutionStatus.OUTPUT_LIMIT_EXCEEDED,),
+    ),
+    Attack(
+        "infinite_loop",
+        "while True: pass",
+        (ExecutionStatus.TIMEOUT,),
+        request={"timeout_ms": 1000},
+    ),
+    Attack(
+        "sleep_past_timeout",
+        "import time\ntime.sleep(60)",
+        (ExecutionStatus.TIMEOUT,),
+        request={"timeout_ms": 1000},
+    ),
+    Attack(
+        "python_memory_bomb",
+        "data = bytearray(512 * 1024 * 1024)",
+        (ExecutionStatus.MEMORY_LIMIT_EXCEEDED,),
+        request={"memory_limit_bytes": 64 * 1024 * 1024},
+    ),
+    Attack(
+        "cpp_memory_bomb",
+        "#include <vector>\nint main() { std::vector<char> v(512 << 20, 1); return v[v.size() - 1] - 1; }\n",
+        (ExecutionStatus.MEMORY_LIMIT_EXCEEDED,),
+        language=Language.CPP,
+        request={"memory_limit_bytes": 64 * 1024 * 1024},
+    ),
+]
+
+
+@pytest.fixture
+def execution_service():
+    return CodeExecutionService(pull_images=False)
+
+
+def _sandbox_containers() -> int:
+    return len(docker.from_env().containers.list(all=True, filters={"label": EXECUTION_LABEL}))
+
+
+class TestSandboxEscapes:
+    """Every attack is contained with the right status and leaves the host untouched."""
+
+    @pytest.mark.parametrize("attack", [
+        pytest.param(attack, id=attack.name, marks=[requires_image(attack.image), requires_image(CANARY_IMAGE)])
+        for attack in ATTACKS
+    ])
+    @pytest.mark.asyncio
+    async def test_attack_is_contained(self, execution_service, attack):
+        request = RunRequest(code=attack.code, language=attack.language, **attack.request)
+        timeout_seconds = execution_service._timeout_for(request, execution_service.validate(request))
+        containers_before = _sandbox_containers()
+        
+        started = time.monotonic()
+        result = await execution_service.run_code(request)
+        elapsed = time.monotonic() - started
+        
+        assert result.status in attack.statuses, f"{attack.name}: {result.status} ({result.error_message})"
+        if attack.stdout is not None:
+            assert result.stdout == attack.stdout
+        deadline = timeout_seconds + execution_service.kill_grace_seconds + EXECUTION_DEADLINE_GRACE_SECONDS
+        assert elapsed < deadline + HOST_DEADLINE_SLACK_SECONDS
+        assert _sandbox_containers() == containers_before
+        
+        canary = await execution_service.run_code(RunRequest(code="print('ok')", language=Language.PYTHON))
+        assert canary.status == ExecutionStatus.SUCCESS
+        assert canary.stdout == "ok\n"
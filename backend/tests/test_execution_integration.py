@@ -0,0 +1,868 @@
+"""
+Integration tests that run real submissions through the executor images.
+
+These need a reachable Docker daemon and the images built by
+scripts/build-execution-images.sh; they are skipped otherwise.
+"""
+
+import base64
+import statistics
+import time
+
+import pytest
+import docker
+
+from app.services.execution import EXECUTION_DEADLINE_GRACE_SECONDS, CodeExecutionService
+from app.services.execution_benchmark import benchmark
+from app.services.execution_binary import elf_architecture
+from app.services.execution_interactive import InteractiveRunner
+from app.schemas.execution import (
+    CodeExecutionRequest,
+    ExecutionStatus,
+    Language,
+    OutputEncoding,
+    RunRequest,
+    TestCase,
+)
+
+
+def _image_available(image: str) -> bool:
+    try:
+        client = docker.from_env()
+        client.images.get(image)
+        return True
+    except Exception:
+        return False
+
+
+def requires_image(image: str):
+    """Skip a test unless the given executor image is present locally."""
+    return pytest.mark.skipif(
+        not _image_available(image),
+        reason=f"Docker image {image} not available"
+    )
+
+
+@pytest.fixture
+def execution_service():
+    # Tests only run against locally built images; don't hit a registry for the rest
+    return CodeExecutionService(pull_images=False)
+
+
+class TestPythonExecution:
+    """Python submissions against the assessment-python-executor image."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_hello_world(self, execution_service):
+        request = CodeExecutionRequest(
+            code='print("hi")',
+            language=Language.PYTHON,
+            test_cases=[TestCase(input="", expected_output="hi")]
+        )
+        
+        result = await execution_service.execute_code(request)
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.test_results[0].actual_output == "hi"
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_run_code_stdout(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code='print("hi")', language=Language.PYTHON)
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "hi\n"
+        assert result.exit_code == 0
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_non_utf8_output_round_trips(self, execution_service):
+        result = await execution_service.run_code(RunRequest(
+            code="import sys\nsys.stdout.buffer.write(b'\\xff\\xfe')",
+            language=Language.PYTHON,
+            output_encoding=OutputEncoding.BASE64
+        ))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert base64.b64decode(result.stdout_base64) == b"\xff\xfe"
+        assert result.stdout == "\ufffd\ufffd"
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_stdin_is_read_until_eof(self, execution_service):
+        code = "import sys\nprint(sum(int(line) for line in sys.stdin))"
+        result = await execution_service.run_code(
+            RunRequest(code=code, language=Language.PYTHON, stdin="5\n10\n")
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout.strip() == "15"
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_infinite_loop_times_out(self, execution_service):
+        started = time.monotonic()
+        result = await execution_service.run_code(
+            RunRequest(code="while True: pass", language=Language.PYTHON, timeout_ms=1000)
+        )
+        
+        assert result.status == ExecutionStatus.TIMEOUT
+        assert result.timed_out
+        assert time.monotonic() - started < 1 + EXECUTION_DEADLINE_GRACE_SECONDS + 5
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_timeout_keeps_output_before_the_hang(self, execution_service):
+        result = await execution_service.run_code(RunRequest(
+            code="print('step 1')\nwhile True: pass", language=Language.PYTHON, timeout_ms=1000
+        ))
+        
+        assert result.status == ExecutionStatus.TIMEOUT
+        assert result.timed_out
+        assert result.stdout == "step 1\n"
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_output_bomb_is_output_limit_exceeded(self, execution_service):
+        started = time.monotonic()
+        result = await execution_service.run_code(
+            RunRequest(code="while True: print('x')", language=Language.PYTHON)
+        )
+        
+        assert result.status == ExecutionStatus.OUTPUT_LIMIT_EXCEEDED
+        assert len(result.stdout) == 64 * 1024
+        assert time.monotonic() - started < 5
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_memory_bomb_is_memory_limit_exceeded(self, execution_service):
+        result = await execution_service.run_code(RunRequest(
+            code="data = bytearray(512 * 1024 * 1024)",
+            language=Language.PYTHON,
+            memory_limit_bytes=64 * 1024 * 1024
+        ))
+        
+        assert result.status == ExecutionStatus.MEMORY_LIMIT_EXCEEDED
+        assert result.memory_used_bytes > 0
+
+
+class TestInteractiveExecution:
+    """Judges talking to a live program over its stdin and stdout."""
+
+    GUESSER = (
+        "lo, hi = 1, 100\n"
+        "while True:\n"
+        "    guess = (lo + hi) // 2\n"
+        "    print(guess, flush=True)\n"
+        "    reply = input()\n"
+        "    if reply == 'correct':\n"
+        "        break\n"
+        "    lo, hi = (guess + 1, hi) if reply == 'higher' else (lo, guess - 1)\n"
+    )
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_guessing_game(self, execution_service):
+        def judge(session):
+            for _ in range(7):
+                guess = int(session.receive())
+                if guess == 73:
+                    session.send("correct")
+                    return True
+                session.send("higher" if guess < 73 else "lower")
+            return False
+        
+        result = await InteractiveRunner(execution_service).run(
+            RunRequest(code=self.GUESSER, language=Language.PYTHON), judge
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.accepted
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_unflushed_output_times_out_the_turn(self, execution_service):
+        result = await InteractiveRunner(execution_service).run(
+            RunRequest(code="print(50)\ninput()", language=Language.PYTHON),
+            lambda session: session.receive() == "50",
+            turn_timeout_seconds=0.5
+        )
+        
+        assert result.status == ExecutionStatus.TIMEOUT
+
+
+class TestKillGracePeriod:
+    """Timed-out programs get SIGTERM and a grace period before SIGKILL."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_sigterm_handler_prints_shutdown_message(self, execution_service):
+        code = (
+            "import signal, sys, time\n"
+            "def stop(signum, frame):\n"
+            "    print('cleaning up', flush=True)\n"
+            "    sys.exit(0)\n"
+            "signal.signal(signal.SIGTERM, stop)\n"
+            "while True:\n"
+            "    time.sleep(0.1)\n"
+        )
+        result = await execution_service.run_code(
+            RunRequest(code=code, language=Language.PYTHON, timeout_ms=1000)
+        )
+        
+        assert result.status == ExecutionStatus.TIMEOUT
+        assert result.stdout == "cleaning up\n"
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_program_ignoring_sigterm_is_killed(self, execution_service):
+        code = "import signal, time\nsignal.signal(signal.SIGTERM, signal.SIG_IGN)\nwhile True:\n    time.sleep(0.1)\n"
+        started = time.monotonic()
+        result = await execution_service.run_code(
+            RunRequest(code=code, language=Language.PYTHON, timeout_ms=1000)
+        )
+        
+        assert result.status == ExecutionStatus.TIMEOUT
+        assert time.monotonic() - started < 1 + execution_service.kill_grace_seconds + EXECUTION_DEADLINE_GRACE_SECONDS + 5
+
+
+class TestGoExecution:
+    """Go submissions against the assessment-go-executor image."""
+
+    @requires_image("assessment-go-executor")
+    @pytest.mark.asyncio
+    async def test_main_imports_helper_package(self, execution_service):
+        files = {
+            "main.go": 'package main\n\nimport (\n\t"fmt"\n\t"submission/helper"\n)\n\nfunc main() { fmt.Println(helper.Greet()) }\n',
+            "helper/helper.go": 'package helper\n\nfunc Greet() string { return "hello from helper" }\n',
+        }
+        result = await execution_service.run_code(
+            RunRequest(files=files, language=Language.GO, entry_point="main.go")
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "hello from helper\n"
+
+
+class TestNetworkIsolation:
+    """Sandboxes have no network namespace, whatever the image ships with."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_outbound_connection_is_unreachable(self, execution_service):
+        # socket.py is stripped from the image, but the C module still opens raw sockets
+        code = (
+            "import _socket\n"
+            "s = _socket.socket(_socket.AF_INET, _socket.SOCK_STREAM)\n"
+            "s.settimeout(5)\n"
+            "s.connect(('1.1.1.1', 80))\n"
+        )
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.PYTHON))
+        
+        assert result.status == ExecutionStatus.RUNTIME_ERROR
+        assert "Network is unreachable" in result.stderr
+
+
+class TestReadOnlyRootFilesystem:
+    """Only the tmpfs workdir and /tmp are writable inside a sandbox."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_system_files_cannot_be_written(self, execution_service):
+        code = (
+            "import os\n"
+            "for path in ('/etc/foo', '/app/code/foo'):\n"
+            "    try:\n"
+            "        with open(path, 'w') as f:\n"
+            "            f.write('x')\n"
+            "        print(path, 'ok')\n"
+            "    except OSError as e:\n"
+            "        print(path, os.strerror(e.errno))\n"
+        )
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.PYTHON))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout.splitlines() == ["/etc/foo Read-only file system", "/app/code/foo ok"]
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_compiled_binary_runs_from_workdir(self, execution_service):
+        code = '#include <cstdio>\nint main() { std::puts("built"); }\n'
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.CPP))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "built\n"
+
+
+class TestDataFiles:
+    """Data files are readable under /app/data but can't be changed."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_data_file_readable_not_writable(self, execution_service):
+        code = (
+            "import os\n"
+            "print(open('/app/data/input.txt').read().split())\n"
+            "for path in ('/app/data/input.txt', '/app/data/new.txt'):\n"
+            "    try:\n"
+            "        open(path, 'w').close()\n"
+            "        print(path, 'ok')\n"
+            "    except OSError as e:\n"
+            "        print(path, os.strerror(e.errno))\n"
+            "try:\n"
+            "    os.chmod('/app/data/input.txt', 0o666)\n"
+            "except OSError as e:\n"
+            "    print('chmod', os.strerror(e.errno))\n"
+        )
+        result = await execution_service.run_code(
+            RunRequest(code=code, language=Language.PYTHON, data_files={"input.txt": b"3 1 2\n"})
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout.splitlines() == [
+            "['3', '1', '2']",
+            "/app/data/input.txt Permission denied",
+            "/app/data/new.txt Permission denied",
+            "chmod Operation not permitted",
+        ]
+
+
+class TestProcessLimit:
+    """The sandbox's cgroup pids limit stops fork bombs."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_fork_bomb_is_contained(self, execution_service):
+        code = "import os\nwhile True:\n    os.fork()\n"
+        started = time.monotonic()
+        result = await execution_service.run_code(
+            RunRequest(code=code, language=Language.PYTHON, timeout_ms=3000)
+        )
+        
+        assert result.status in (ExecutionStatus.RUNTIME_ERROR, ExecutionStatus.TIMEOUT)
+        assert time.monotonic() - started < 3 + EXECUTION_DEADLINE_GRACE_SECONDS + 5
+
+
+class TestSeccompProfile:
+    """The bundled seccomp profile denies dangerous syscalls."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_ptrace_is_denied(self, execution_service):
+        code = (
+            "import ctypes, os\n"
+            "libc = ctypes.CDLL(None, use_errno=True)\n"
+            "print(libc.ptrace(0, 0, None, None), os.strerror(ctypes.get_errno()))\n"  # PTRACE_TRACEME
+        )
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.PYTHON))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "-1 Operation not permitted\n"
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_new_namespaces_are_denied(self, execution_service):
+        code = (
+            "import ctypes, os\n"
+            "libc = ctypes.CDLL(None, use_errno=True)\n"
+            "print(libc.unshare(0x10000000), os.strerror(ctypes.get_errno()))\n"  # CLONE_NEWUSER
+        )
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.PYTHON))
+        
+        assert result.stdout == "-1 Operation not permitted\n"
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_personality_is_denied(self, execution_service):
+        code = (
+            "import ctypes, os\n"
+            "libc = ctypes.CDLL(None, use_errno=True)\n"
+            "print(libc.personality(0x0040000), os.strerror(ctypes.get_errno()))\n"  # ADDR_NO_RANDOMIZE
+        )
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.PYTHON))
+        
+        assert result.stdout == "-1 Operation not permitted\n"
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_unlisted_syscalls_are_denied(self, execution_service):
+        code = (
+            "import ctypes, os\n"
+            "libc = ctypes.CDLL(None, use_errno=True)\n"
+            "print(libc.syscall(1000), os.strerror(ctypes.get_errno()))\n"  # no such syscall yet
+        )
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.PYTHON))
+        
+        assert result.stdout == "-1 Operation not permitted\n"
+
+
+class TestCpuQuota:
+    """CPU quota throttles CPU-bound programs in proportion to the cores granted."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_half_core_takes_about_twice_as_long(self, execution_service):
+        code = "total = 0\nfor i in range(20_000_000):\n    total += i\nprint(total)"
+        
+        async def run_ms(cpu_quota):
+            result = await execution_service.run_code(
+                RunRequest(code=code, language=Language.PYTHON, cpu_quota=cpu_quota, timeout_ms=60000)
+            )
+            assert result.status == ExecutionStatus.SUCCESS
+            return result.run_duration_ms
+        
+        full_core = await run_ms(1.0)
+        half_core = await run_ms(0.5)
+        
+        print(f"cpu-bound run: 1.0 cpus {full_core}ms, 0.5 cpus {half_core}ms")
+        assert 1.5 < half_core / full_core < 2.6
+
+
+class TestContainerPoolLatency:
+    """Warm-pool runs compared with starting a container per submission."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_pool_lowers_median_latency(self):
+        async def median_latency(service, runs=10):
+            durations = []
+            for _ in range(runs):
+                started = time.monotonic()
+                result = await service.run_code(RunRequest(code='print("hi")', language=Language.PYTHON))
+                durations.append(time.monotonic() - started)
+                assert result.status == ExecutionStatus.SUCCESS
+            return statistics.median(durations)
+        
+        cold = await median_latency(CodeExecutionService(pull_images=False))
+        pooled_service = CodeExecutionService(pool_size=1, pull_images=False)
+        try:
+            pooled = await median_latency(pooled_service)
+        finally:
+            pooled_service.pool.close()
+        
+        print(f"median latency: cold {cold * 1000:.0f}ms, pooled {pooled * 1000:.0f}ms")
+        assert pooled < cold
+
+
+class TestContainerPoolIsolation:
+    """What one pooled submission can leave behind for the next."""
+
+    LEAVE_BEHIND = (
+        "import subprocess\n"
+        "subprocess.Popen(['sleep', '300'], start_new_session=True, stdin=subprocess.DEVNULL,\n"
+        "                 stdout=subprocess.DEVNULL, stderr=subprocess.DEVNULL)\n"
+        "open('/dev/shm/left-behind', 'w').write('secret')\n"
+    )
+    LOOK_AROUND = (
+        "import os\n"
+        "for pid in filter(str.isdigit, os.listdir('/proc')):\n"
+        "    print(open(f'/proc/{pid}/cmdline').read().replace('\\0', ' '))\n"
+        "print(os.listdir('/dev/shm'))\n"
+    )
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_background_process_does_not_survive_release(self):
+        pooled_service = CodeExecutionService(pool_size=1, pull_images=False)
+        try:
+            left = await pooled_service.run_code(RunRequest(code=self.LEAVE_BEHIND, language=Language.PYTHON))
+            looked = await pooled_service.run_code(RunRequest(code=self.LOOK_AROUND, language=Language.PYTHON))
+        finally:
+            pooled_service.pool.close()
+        
+        assert left.status == ExecutionStatus.SUCCESS
+        assert looked.status == ExecutionStatus.SUCCESS
+        assert "sleep 300" not in looked.stdout
+        assert "left-behind" not in looked.stdout
+
+
+class TestBenchmark:
+    """Executor overhead measured with the benchmark's trivial programs."""
+
+    @requires_image("assessment-python-executor")
+    @pytest.mark.asyncio
+    async def test_pooled_runs_save_container_start(self, execution_service):
+        report = await benchmark(Language.PYTHON, iterations=5, service=execution_service)
+        
+        print(report.model_dump_json(indent=2))
+        assert report.image_pull_ms == 0
+        assert report.container_start.min_ms > 0
+        assert report.cold_total.min_ms >= report.run.min_ms
+        assert report.pooled_saving_ms > 0
+
+
+class TestCppExecution:
+    """C++ submissions against the assessment-cpp-executor image."""
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_hello_world(self, execution_service):
+        code = '#include <iostream>\nint main() { std::cout << "hello" << std::endl; }\n'
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.CPP))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "hello\n"
+        assert result.stderr == ""
+        assert result.compile_duration_ms > 0
+        assert result.run_duration_ms > 0
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_compile_error(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code="int main( {", language=Language.CPP)
+        )
+        
+        assert result.status == ExecutionStatus.COMPILATION_ERROR
+        assert "error" in result.stderr
+        assert result.stdout == ""
+        assert result.exit_code != 0
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_null_dereference_reports_sigsegv(self, execution_service):
+        code = "#include <cstdio>\nint main() { volatile int *p = nullptr; std::printf(\"%d\\n\", *p); }\n"
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.CPP))
+        
+        assert result.status == ExecutionStatus.RUNTIME_ERROR
+        assert result.exit_code == 139
+        assert result.signal == "SIGSEGV"
+        assert "Segmentation fault" in result.error_message
+
+
+class TestBuiltTestCases:
+    """Compiled submissions run against many test cases from a single build."""
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_cases_share_the_build_but_not_state(self, execution_service):
+        # Each case leaves files behind and a process running; the next must see neither, nor the snapshot
+        code = (
+            '#include <cstdio>\n#include <cstdlib>\n#include <unistd.h>\n'
+            'int main() {\n'
+            '  int n; if (scanf("%d", &n) != 1) return 1;\n'
+            '  if (access("left-behind", F_OK) == 0 || access("/tmp/left-behind", F_OK) == 0\n'
+            '      || access("/dev/shm/left-behind", F_OK) == 0) { puts("dirty"); return 0; }\n'
+            '  if (access("/run/codehub/workdir.tar", R_OK) == 0) { puts("snapshot readable"); return 0; }\n'
+            '  fclose(fopen("left-behind", "w")); fclose(fopen("/tmp/left-behind", "w"));\n'
+            '  fclose(fopen("/dev/shm/left-behind", "w"));\n'
+            '  if (fork() == 0) { close(1); close(2); setsid(); sleep(30); return 0; }\n'
+            '  printf("%d\\n", n * 2);\n'
+            '}\n'
+        )
+        results = await execution_service.run_test_cases(
+            RunRequest(code=code, language=Language.CPP),
+            [TestCase(input=str(i), expected_output=str(i * 2)) for i in range(5)]
+        )
+        
+        assert [r.actual_output for r in results] == [str(i * 2) for i in range(5)]
+        assert results[0].run.compile_duration_ms > 0
+        assert all(r.run.compile_duration_ms == 0 for r in results[1:])
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_fifty_cases_beat_fifty_builds(self, execution_service):
+        code = '#include <iostream>\nint main() { int n; std::cin >> n; std::cout << n << std::endl; }\n'
+        request = RunRequest(code=code, language=Language.CPP)
+        
+        singles = []
+        for i in range(3):
+            started = time.monotonic()
+            result = await execution_service.run_code(request.model_copy(update={"stdin": str(i)}))
+            singles.append(time.monotonic() - started)
+            assert result.status == ExecutionStatus.SUCCESS
+        
+        started = time.monotonic()
+        results = await execution_service.run_test_cases(
+            request, [TestCase(input=str(i), expected_output=str(i)) for i in range(50)]
+        )
+        built_once = time.monotonic() - started
+        
+        independent = 50 * statistics.median(singles)
+        print(f"50 cases: built once {built_once:.1f}s, independent builds ~{independent:.1f}s")
+        assert all(r.passed for r in results)
+        assert built_once < independent / 2
+
+
+# Allocates and touches the number of MB read from stdin; spins forever when it's negative
+STATIC_BINARY_SOURCE = (
+    '#include <cstdio>\n#include <cstdlib>\n#include <cstring>\n'
+    'int main() {\n'
+    '  long mb; if (scanf("%ld", &mb) != 1) return 2;\n'
+    '  if (mb < 0) for (volatile long i = 0;; i++) {}\n'
+    '  char *p = (char *)malloc(mb << 20); if (!p) return 3;\n'
+    '  memset(p, 1, mb << 20);\n'
+    '  puts("ok");\n'
+    '}\n'
+)
+
+
+@pytest.fixture(scope="module")
+def static_binary():
+    """STATIC_BINARY_SOURCE built offline, as a caller would, with the C++ executor image's g++."""
+    encoded = base64.b64encode(STATIC_BINARY_SOURCE.encode()).decode()
+    return docker.from_env().containers.run(
+        "assessment-cpp-executor",
+        f"sh -c 'echo {encoded} | base64 -d > /tmp/m.cpp && g++ -O2 -static /tmp/m.cpp -o /tmp/m && cat /tmp/m'",
+        remove=True
+    )
+
+
+class TestBinaryUpload:
+    """Precompiled static binaries run in the C++ sandbox under its usual limits."""
+
+    @pytest.fixture
+    def binary_service(self):
+        return CodeExecutionService(pull_images=False, allow_binary_upload=True)
+
+    def _request(self, binary, stdin, **limits):
+        return RunRequest(
+            binary=base64.b64encode(binary), binary_arch=elf_architecture(binary),
+            language=Language.CPP, stdin=stdin, **limits
+        )
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_static_binary_runs(self, binary_service, static_binary):
+        result = await binary_service.run_code(self._request(static_binary, "1"))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "ok\n"
+        assert result.compile_duration_ms == 0
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_memory_limit_applies(self, binary_service, static_binary):
+        result = await binary_service.run_code(
+            self._request(static_binary, "256", memory_limit_bytes=64 * 1024 * 1024)
+        )
+        
+        assert result.status == ExecutionStatus.MEMORY_LIMIT_EXCEEDED
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_timeout_applies(self, binary_service, static_binary):
+        started = time.monotonic()
+        result = await binary_service.run_code(self._request(static_binary, "-1", timeout_ms=1000))
+        
+        assert result.status == ExecutionStatus.TIMEOUT
+        assert time.monotonic() - started < 1 + EXECUTION_DEADLINE_GRACE_SECONDS + 5
+
+
+class TestRustExecution:
+    """Rust submissions against the assessment-rust-executor image."""
+
+    @requires_image("assessment-rust-executor")
+    @pytest.mark.asyncio
+    async def test_hello_world(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code='fn main() { println!("hello"); }', language=Language.RUST)
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "hello\n"
+
+    @requires_image("assessment-rust-executor")
+    @pytest.mark.asyncio
+    async def test_compile_error(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code="fn main() { let x: i32 = \"no\"; }", language=Language.RUST)
+        )
+        
+        assert result.status == ExecutionStatus.COMPILATION_ERROR
+        assert "mismatched types" in result.stderr
+
+
+class TestPhpExecution:
+    """PHP submissions against the assessment-php-executor image."""
+
+    @requires_image("assessment-php-executor")
+    @pytest.mark.asyncio
+    async def test_hello_world(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code='<?php echo "hi";', language=Language.PHP)
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "hi"
+
+    @requires_image("assessment-php-executor")
+    @pytest.mark.asyncio
+    async def test_reads_stdin(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code='<?php echo trim(fgets(STDIN)) * 2, "\\n";', language=Language.PHP, stdin="21\n")
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "42\n"
+
+    @requires_image("assessment-php-executor")
+    @pytest.mark.asyncio
+    async def test_parse_error(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code='<?php echo "hi"', language=Language.PHP)
+        )
+        
+        assert result.status == ExecutionStatus.COMPILATION_ERROR
+        assert "Parse error" in result.stderr
+
+    @requires_image("assessment-php-executor")
+    @pytest.mark.asyncio
+    async def test_fatal_error(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code="<?php missing();", language=Language.PHP)
+        )
+        
+        assert result.status == ExecutionStatus.RUNTIME_ERROR
+        assert "Call to undefined function" in result.stderr
+        assert result.stdout == ""
+
+
+class TestTypeScriptExecution:
+    """TypeScript submissions against the assessment-typescript-executor image."""
+
+    @requires_image("assessment-typescript-executor")
+    @pytest.mark.asyncio
+    async def test_typed_program_reads_stdin(self, execution_service):
+        code = (
+            'import { readFileSync } from "fs";\n'
+            'interface Pair { a: number; b: number }\n'
+            'const [a, b] = readFileSync(0, "utf8").trim().split(/\\s+/).map(Number);\n'
+            'const pair: Pair = { a, b };\n'
+            'console.log(pair.a + pair.b);\n'
+        )
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.TYPESCRIPT, stdin="20 22\n"))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "42\n"
+        assert result.compile_duration_ms > 0
+        assert result.run_duration_ms > 0
+
+    @requires_image("assessment-typescript-executor")
+    @pytest.mark.asyncio
+    async def test_type_error(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code='const n: number = "forty-two";\nconsole.log(n);\n', language=Language.TYPESCRIPT)
+        )
+        
+        assert result.status == ExecutionStatus.COMPILATION_ERROR
+        assert "error TS2322" in result.stderr
+        assert result.stdout == ""
+
+    @requires_image("assessment-typescript-executor")
+    @pytest.mark.asyncio
+    async def test_multi_file_entry_point(self, execution_service):
+        files = {
+            "src/app.ts": 'import { twice } from "./lib";\nconsole.log(twice(21));\n',
+            "src/lib.ts": "export const twice = (n: number): number => n * 2;\n",
+        }
+        result = await execution_service.run_code(
+            RunRequest(files=files, language=Language.TYPESCRIPT, entry_point="src/app.ts")
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "42\n"
+
+
+class TestCompileArgs:
+    """Compiler flags passed through to real toolchains."""
+
+    @requires_image("assessment-cpp-executor")
+    @pytest.mark.asyncio
+    async def test_werror_fails_on_warning(self, execution_service):
+        code = "int main() { int unused; return 0; }\n"
+        lenient = await execution_service.run_code(RunRequest(code=code, language=Language.CPP))
+        strict = await execution_service.run_code(
+            RunRequest(code=code, language=Language.CPP, compile_args=["-Wall", "-Werror"])
+        )
+        
+        assert lenient.status == ExecutionStatus.SUCCESS
+        assert strict.status == ExecutionStatus.COMPILATION_ERROR
+        assert "unused" in strict.stderr
+
+    @requires_image("assessment-go-executor")
+    @pytest.mark.asyncio
+    async def test_go_race_detector_builds(self, execution_service):
+        code = 'package main\n\nimport "fmt"\n\nfunc main() { fmt.Println("raced") }\n'
+        result = await execution_service.run_code(RunRequest(
+            code=code, language=Language.GO, compile_args=["-race"],
+            memory_limit_bytes=512 * 1024 * 1024
+        ))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "raced\n"
+
+
+class TestJavaScriptExecution:
+    """JavaScript submissions against the Node.js 20 assessment-js-executor image."""
+
+    @requires_image("assessment-js-executor")
+    @pytest.mark.asyncio
+    async def test_hello_world(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code="console.log('hi')", language=Language.JAVASCRIPT)
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "hi\n"
+        assert result.stderr == ""
+
+    @requires_image("assessment-js-executor")
+    @pytest.mark.asyncio
+    async def test_readline_reads_stdin(self, execution_service):
+        code = (
+            "const rl = require('readline').createInterface({ input: process.stdin });\n"
+            "let sum = 0;\n"
+            "rl.on('line', line => { sum += Number(line); });\n"
+            "rl.on('close', () => console.log(sum));\n"
+        )
+        result = await execution_service.run_code(
+            RunRequest(code=code, language=Language.JAVASCRIPT, stdin="5\n3\n")
+        )
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "8\n"
+
+    @requires_image("assessment-js-executor")
+    @pytest.mark.asyncio
+    async def test_uncaught_error(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code="throw new Error('boom');", language=Language.JAVASCRIPT)
+        )
+        
+        assert result.status == ExecutionStatus.RUNTIME_ERROR
+        assert "Error: boom" in result.stderr
+        assert result.exit_code == 1
+
+
+class TestJavaExecution:
+    """Java submissions against the assessment-java-executor image."""
+
+    @requires_image("assessment-java-executor")
+    @pytest.mark.asyncio
+    async def test_hello_world(self, execution_service):
+        code = (
+            "public class Main {\n"
+            "    public static void main(String[] args) {\n"
+            "        System.out.println(\"hello\");\n"
+            "    }\n"
+            "}\n"
+        )
+        result = await execution_service.run_code(RunRequest(code=code, language=Language.JAVA))
+        
+        assert result.status == ExecutionStatus.SUCCESS
+        assert result.stdout == "hello\n"
+
+    @requires_image("assessment-java-executor")
+    @pytest.mark.asyncio
+    async def test_compile_error(self, execution_service):
+        result = await execution_service.run_code(
+            RunRequest(code="public class Main { int x = 1 }", language=Language.JAVA)
+        )
+        
+        assert result.status == ExecutionStatus.COMPILATION_ERROR
+        assert "error" in result.stderr
+        assert result.stdout == ""
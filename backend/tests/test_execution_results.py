@@ -0,0 +1,84 @@
+import pytest
+from app.schemas.execution import ExecutionStatus, RunResult
+from app.services.execution_results import PostgresResultStore, STORED_OUTPUT_CHARS
+from tests.conftest import TestingSessionLocal
+
+
+@pytest.fixture
+def store(db):
+    return PostgresResultStore(TestingSessionLocal)
+
+
+def test_save_and_get(store):
+    """Test a saved result round-trips with its language, timings and timestamp"""
+    result = RunResult(
+        status=ExecutionStatus.RUNTIME_ERROR,
+        stdout="partial\n",
+        stderr="Traceback...\n",
+        exit_code=1,
+        duration_ms=120,
+        compile_duration_ms=0,
+        run_duration_ms=95,
+        memory_used_bytes=8 * 1024 * 1024
+    )
+
+    store.save("submission-1", result, "python")
+
+    stored = store.get("submission-1")
+    assert stored.submission_id == "submission-1"
+    assert stored.language == "python"
+    assert stored.created_at is not None
+    assert stored.result == result
+
+
+def test_signal_round_trips(store):
+    """Test the signal that killed a run is stored and read back"""
+    result = RunResult(
+        status=ExecutionStatus.RUNTIME_ERROR,
+        exit_code=139,
+        signal="SIGSEGV",
+        error_message="Segmentation fault (invalid memory access)"
+    )
+
+    store.save("submission-1", result, "cpp")
+
+    assert store.get("submission-1").result.signal == "SIGSEGV"
+
+
+def test_unmeasured_memory_round_trips(store):
+    """Test a result whose memory couldn't be measured is stored and read back as None, not 0"""
+    store.save("submission-1", RunResult(status=ExecutionStatus.SUCCESS, stdout="ok\n"), "cpp")
+
+    assert store.get("submission-1").result.memory_used_bytes is None
+
+
+def test_get_filters_by_submitter(store, test_user, instructor_user):
+    """Test a result is only found for the user who submitted it, when a user is given"""
+    store.save("submission-1", RunResult(status=ExecutionStatus.SUCCESS, stdout="ok\n"), "python", test_user.id)
+
+    assert store.get("submission-1", test_user.id).user_id == test_user.id
+    assert store.get("submission-1", instructor_user.id) is None
+    assert store.get("submission-1").result.stdout == "ok\n"
+
+
+def test_get_unknown_submission(store):
+    """Test an unknown submission has no stored result"""
+    assert store.get("missing") is None
+
+
+def test_save_replaces_earlier_result(store):
+    """Test saving again for a submission updates the existing row"""
+    store.save("submission-1", RunResult(status=ExecutionStatus.TIMEOUT, timed_out=True), "go")
+    store.save("submission-1", RunResult(status=ExecutionStatus.SUCCESS, stdout="ok\n"), "go")
+
+    stored = store.get("submission-1")
+    assert stored.result.status == ExecutionStatus.SUCCESS
+    assert stored.result.timed_out is False
+    assert stored.result.stdout == "ok\n"
+
+
+def test_save_truncates_output(store):
+    """Test stored output is cut to STORED_OUTPUT_CHARS"""
+    store.save("submission-1", RunResult(status=ExecutionStatus.SUCCESS, stdout="x" * (STORED_OUTPUT_CHARS + 1)), "python")
+
+    assert len(store.get("submission-1").result.stdout) == STORED_OUTPUT_CHARS
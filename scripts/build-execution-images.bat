@@ -7,7 +7,7 @@ echo Building Docker images for code execution...
 REM Define languages and their Dockerfiles
 set "languages=python javascript java cpp csharp go rust"
 set "dockerfile_python=backend/docker/execution/Dockerfile.python"
-set "dockerfile_javascript=backend/docker/execution/Dockerfile.javascript"
+set "dockerfile_javascript=backend/docker/execution/Dockerfile.node"
 set "dockerfile_java=backend/docker/execution/Dockerfile.java"
 set "dockerfile_cpp=backend/docker/execution/Dockerfile.cpp"
 set "dockerfile_csharp=backend/docker/execution/Dockerfile.csharp"
@@ -23,6 +23,14 @@ for %%l in (%languages%) do (
     )
 )
 
+REM Pinned toolchain variants built from the same Dockerfiles
+echo Building assessment-go1.22-executor (Go 1.22)...
+docker build -f "%dockerfile_go%" --build-arg "GO_VERSION=1.22" -t "assessment-go1.22-executor" .
+if errorlevel 1 (
+    echo Failed to build assessment-go1.22-executor
+    exit /b 1
+)
+
 echo.
 echo All Docker images built successfully!
 echo.
@@ -37,6 +45,7 @@ echo docker run --rm assessment-java-executor java --version
 echo docker run --rm assessment-cpp-executor g++ --version
 echo docker run --rm assessment-csharp-executor dotnet --version
 echo docker run --rm assessment-go-executor go version
+echo docker run --rm assessment-go1.22-executor go version
 echo docker run --rm assessment-rust-executor rustc --version
 
 goto :eof
@@ -10,12 +10,14 @@ echo "Building Docker images for code execution..."
 # Array of languages and their corresponding Dockerfiles
 declare -A LANGUAGES=(
     ["python"]="backend/docker/execution/Dockerfile.python"
-    ["javascript"]="backend/docker/execution/Dockerfile.javascript"
+    ["javascript"]="backend/docker/execution/Dockerfile.node"
     ["java"]="backend/docker/execution/Dockerfile.java"
     ["cpp"]="backend/docker/execution/Dockerfile.cpp"
     ["csharp"]="backend/docker/execution/Dockerfile.csharp"
     ["go"]="backend/docker/execution/Dockerfile.go"
     ["rust"]="backend/docker/execution/Dockerfile.rust"
+    ["php"]="backend/docker/execution/Dockerfile.php"
+    ["typescript"]="backend/docker/execution/Dockerfile.typescript"
 )
 
 # Build each image
@@ -33,6 +35,24 @@ for lang in "${!LANGUAGES[@]}"; do
     fi
 done
 
+# Pinned toolchain variants built from the same Dockerfiles
+declare -A GO_VERSIONS=(
+    ["1.22"]="assessment-go1.22-executor"
+)
+
+for version in "${!GO_VERSIONS[@]}"; do
+    image_name="${GO_VERSIONS[$version]}"
+    
+    echo "Building $image_name (Go $version)..."
+    
+    if docker build -f "backend/docker/execution/Dockerfile.go" --build-arg "GO_VERSION=$version" -t "$image_name" .; then
+        echo "✅ Successfully built $image_name"
+    else
+        echo "❌ Failed to build $image_name"
+        exit 1
+    fi
+done
+
 echo ""
 echo "🎉 All Docker images built successfully!"
 echo ""
@@ -47,4 +67,7 @@ echo "docker run --rm assessment-java-executor java --version"
 echo "docker run --rm assessment-cpp-executor g++ --version"
 echo "docker run --rm assessment-csharp-executor dotnet --version"
 echo "docker run --rm assessment-go-executor go version"
-echo "docker run --rm assessment-rust-executor rustc --version"
\ No newline at end of file
+echo "docker run --rm assessment-go1.22-executor go version"
+echo "docker run --rm assessment-rust-executor rustc --version"
+echo "docker run --rm assessment-php-executor php --version"
+echo "docker run --rm assessment-typescript-executor tsc --version"
\ No newline at end of file